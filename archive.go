@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const archiveDir = "archive"
+
+// ArchiveEntry records one answered conversation: what the model was sent,
+// what it replied, and what the provider reported about the reply.
+type ArchiveEntry struct {
+	Time           time.Time        `json:"time"`
+	NotificationID string           `json:"notification_id"`
+	StatusID       string           `json:"status_id"`
+	Acct           string           `json:"acct"`
+	Persona        string           `json:"persona,omitempty"`
+	RequestModel   string           `json:"request_model"`
+	Messages       []Message        `json:"messages"`
+	Response       string           `json:"response"`
+	ToolCalls      []ToolCall       `json:"tool_calls,omitempty"`
+	Usage          *TokenUsage      `json:"usage,omitempty"`
+	Metadata       ResponseMetadata `json:"metadata"`
+	// Authors lists the accounts whose posts each of Messages holds.
+	Authors [][]string `json:"authors,omitempty"`
+}
+
+// archive appends conversations to one JSON Lines file per day under DATA_DIR/archive.
+// A read-only archive, as in DRY_RUN mode, records and forgets nothing.
+type archive struct {
+	mu       sync.Mutex
+	dir      string
+	readOnly bool
+}
+
+func newArchive(data dataDir) *archive {
+	return &archive{dir: filepath.Join(data.path, archiveDir), readOnly: data.readOnly}
+}
+
+func (a *archive) append(entry ArchiveEntry) {
+	if a.readOnly {
+		return
+	}
+	for i, msg := range entry.Messages {
+		if len(msg.authors) > 0 {
+			if entry.Authors == nil {
+				entry.Authors = make([][]string, len(entry.Messages))
+			}
+			entry.Authors[i] = msg.authors
+		}
+	}
+	entry.Messages = withoutImageData(entry.Messages)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to encode archive entry: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		log.Printf("Failed to create archive directory: %v", err)
+		return
+	}
+	path := filepath.Join(a.dir, entry.Time.Format("2006-01-02")+".jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("Failed to open archive: %v", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write archive entry: %v", err)
+	}
+}
+
+// withoutImageData replaces embedded base64 images, which would bloat the archive, with a placeholder.
+func withoutImageData(messages []Message) []Message {
+	out := make([]Message, len(messages))
+	for i, msg := range messages {
+		out[i] = Message{Role: msg.Role, ChatContent: make([]ChatContent, len(msg.ChatContent))}
+		for j, c := range msg.ChatContent {
+			if c.ImageURL != nil && strings.HasPrefix(c.ImageURL.URL, "data:") {
+				c.ImageURL = &ImageContent{URL: "data:[omitted]", Detail: c.ImageURL.Detail}
+			}
+			out[i].ChatContent[j] = c
+		}
+	}
+	return out
+}
+
+// forget removes the conversations of acct from the archive, and the posts
+// of acct from the conversations of others. It returns how many
+// conversations it removed and how many it redacted.
+func (a *archive) forget(acct string) (removed, redacted int, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(a.dir, "*.jsonl"))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return removed, redacted, err
+		}
+		var kept []byte
+		changed := false
+		for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+			var entry ArchiveEntry
+			if json.Unmarshal(line, &entry) != nil {
+				kept = append(kept, line...)
+				continue
+			}
+			if entry.Acct == acct {
+				removed++
+				changed = true
+				continue
+			}
+			if redactAuthor(&entry, acct) {
+				if redactedLine, err := json.Marshal(entry); err == nil {
+					line = append(redactedLine, '\n')
+					redacted++
+					changed = true
+				}
+			}
+			kept = append(kept, line...)
+		}
+		if !changed || a.readOnly {
+			continue
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, kept, 0o600); err != nil {
+			return removed, redacted, err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return removed, redacted, err
+		}
+	}
+	return removed, redacted, nil
+}
+
+// redactAuthor replaces the messages of entry holding posts of acct and
+// reports whether there were any.
+func redactAuthor(entry *ArchiveEntry, acct string) bool {
+	found := false
+	for i, authors := range entry.Authors {
+		if i < len(entry.Messages) && slices.Contains(authors, acct) {
+			entry.Messages[i].ChatContent = []ChatContent{{Type: "text", Text: "[removed]"}}
+			entry.Authors[i] = slices.DeleteFunc(authors, func(a string) bool { return a == acct })
+			found = true
+		}
+	}
+	return found
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// Backend is the fediverse server API the bot runs against, selected by
+// BACKEND. Statuses, accounts and notifications use the Mastodon API shapes
+// of the SDK's models, which other servers are converted to.
+type Backend interface {
+	VerifyCredentials(ctx context.Context) (*models.Account, error)
+	// Notifications returns the newest notifications first.
+	Notifications(ctx context.Context, query NotificationQuery) ([]*models.Notification, error)
+	GetStatus(ctx context.Context, id string) (*models.Status, error)
+	PostStatus(ctx context.Context, post *StatusPost) (*models.Status, error)
+	// DismissNotifications removes handled notifications. Servers that cannot
+	// dismiss them one at a time clear all notifications instead.
+	DismissNotifications(ctx context.Context, ids []string) error
+	UploadMedia(ctx context.Context, data []byte, filename, description string) (*models.Attachment, error)
+	// React reacts to a status with emoji on servers with emoji reactions,
+	// and favourites it otherwise or if emoji is empty.
+	React(ctx context.Context, statusID, emoji string) error
+	// CustomEmojis returns the custom emoji of the server.
+	CustomEmojis(ctx context.Context) ([]*models.Emoji, error)
+	// ThreadContext returns the ancestors of a status, oldest first, and its
+	// descendants.
+	ThreadContext(ctx context.Context, id string) (ancestors, descendants []*models.Status, err error)
+	// EditStatus replaces the text of one of the bot's statuses, keeping its
+	// content warning, sensitivity and language.
+	EditStatus(ctx context.Context, status *models.Status, text string) error
+	DeleteStatus(ctx context.Context, id string) error
+	// Follow follows an account; with notify, its new posts arrive as
+	// status notifications.
+	Follow(ctx context.Context, accountID string, notify bool) error
+	// FollowRequests returns the accounts with pending follow requests.
+	FollowRequests(ctx context.Context, limit int64) ([]*models.Account, error)
+	AuthorizeFollowRequest(ctx context.Context, accountID string) error
+	// SearchAccount looks up an account by its handle, fetching it from its
+	// server if necessary. It returns nil if there is none.
+	SearchAccount(ctx context.Context, acct string) (*models.Account, error)
+	// SearchStatus looks up a status by its URL, fetching it from its server
+	// if necessary. It returns nil if there is none.
+	SearchStatus(ctx context.Context, link string) (*models.Status, error)
+	// QuotedStatus returns the status that a status quotes according to the
+	// server, or nil if it quotes none.
+	QuotedStatus(ctx context.Context, status *models.Status) (*models.Status, error)
+}
+
+// restrictedBackend is implemented by backends lacking features the bot may
+// be configured to use. restrict turns them off in config, logging why.
+type restrictedBackend interface {
+	restrict(config *Config)
+}
+
+// reactionType is the notification type of emoji reactions. Backends append
+// the emoji, as in "reaction:🔁", since models.Notification has no field for it.
+const reactionType = "reaction"
+
+// reactionEmoji returns the emoji of a reaction notification.
+func reactionEmoji(notif *models.Notification) (string, bool) {
+	return strings.CutPrefix(notif.Type, reactionType+":")
+}
+
+// NotificationQuery selects notifications; zero values are left to the server's defaults.
+type NotificationQuery struct {
+	Limit int64
+	MinID string
+	Types []string
+}
+
+// StatusPost is a status to create. Fields a server does not support are ignored.
+type StatusPost struct {
+	Text              string
+	InReplyToID       string
+	Visibility        string
+	Language          string
+	SpoilerText       string
+	Sensitive         bool
+	LocalOnly         bool
+	ContentType       string
+	InteractionPolicy *models.InteractionPolicy
+	Poll              *PollRequest
+	MediaIDs          []string
+}
+
+func newBackend(config Config, gts Client) Backend {
+	switch config.Backend {
+	case "mastodon":
+		return &mastodonBackend{api: gts.API}
+	case "misskey":
+		return &misskeyBackend{api: gts.API}
+	default:
+		return &gtsBackend{gts: gts}
+	}
+}
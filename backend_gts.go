@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/go-openapi/runtime"
+	"github.com/owu-one/gotosocial-sdk/client/accounts"
+	"github.com/owu-one/gotosocial-sdk/client/custom_emojis"
+	"github.com/owu-one/gotosocial-sdk/client/follow_requests"
+	"github.com/owu-one/gotosocial-sdk/client/media"
+	"github.com/owu-one/gotosocial-sdk/client/notifications"
+	"github.com/owu-one/gotosocial-sdk/client/search"
+	"github.com/owu-one/gotosocial-sdk/client/statuses"
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// gtsBackend talks to GoToSocial through its SDK.
+type gtsBackend struct {
+	gts Client
+}
+
+func (g *gtsBackend) VerifyCredentials(ctx context.Context) (*models.Account, error) {
+	resp, err := g.gts.Client.Accounts.AccountVerify(accounts.NewAccountVerifyParams().WithContext(ctx), g.gts.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+func (g *gtsBackend) Notifications(ctx context.Context, query NotificationQuery) ([]*models.Notification, error) {
+	params := notifications.NewNotificationsParams().WithContext(ctx)
+	if query.Limit > 0 {
+		params.SetLimit(&query.Limit)
+	}
+	if query.MinID != "" {
+		params.SetMinID(&query.MinID)
+	}
+	// GoToSocial has no emoji reactions.
+	types := slices.DeleteFunc(slices.Clone(query.Types), func(t string) bool { return t == reactionType })
+	if len(types) > 0 {
+		params.SetTypes(types)
+	}
+	resp, err := g.gts.Client.Notifications.Notifications(params, g.gts.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+func (g *gtsBackend) GetStatus(ctx context.Context, id string) (*models.Status, error) {
+	resp, err := g.gts.Client.Statuses.StatusGet(statuses.NewStatusGetParams().WithContext(ctx).WithID(id), g.gts.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+func (g *gtsBackend) PostStatus(ctx context.Context, post *StatusPost) (*models.Status, error) {
+	params := statuses.NewStatusCreateParams().WithContext(ctx).
+		WithStatus(ptr(post.Text)).
+		WithVisibility(ptr(post.Visibility)).
+		WithSensitive(ptr(post.Sensitive)).
+		WithLocalOnly(ptr(post.LocalOnly))
+	if post.ContentType != "" {
+		params.SetContentType(ptr(post.ContentType))
+	}
+	if post.InReplyToID != "" {
+		params.SetInReplyToID(ptr(post.InReplyToID))
+	}
+	if post.Language != "" {
+		params.SetLanguage(ptr(post.Language))
+	}
+	if post.SpoilerText != "" {
+		params.SetSpoilerText(ptr(post.SpoilerText))
+	}
+	if len(post.MediaIDs) > 0 {
+		params.SetMediaIDs(post.MediaIDs)
+	}
+	if poll := post.Poll; poll != nil {
+		params.SetPollOptions(poll.Options)
+		params.SetPollExpiresIn(&poll.ExpiresIn)
+		params.SetPollMultiple(&poll.Multiple)
+	}
+	if policy := post.InteractionPolicy; policy != nil {
+		if len(policy.CanFavourite.Always) > 0 {
+			params.SetInteractionPolicyCanFavouriteAlways0(ptr(string(policy.CanFavourite.Always[0])))
+		}
+		if len(policy.CanFavourite.WithApproval) > 0 {
+			params.SetInteractionPolicyCanFavouriteWithApproval0(ptr(string(policy.CanFavourite.WithApproval[0])))
+		}
+		if len(policy.CanReblog.Always) > 0 {
+			params.SetInteractionPolicyCanReblogAlways0(ptr(string(policy.CanReblog.Always[0])))
+		}
+		if len(policy.CanReblog.WithApproval) > 0 {
+			params.SetInteractionPolicyCanReblogWithApproval0(ptr(string(policy.CanReblog.WithApproval[0])))
+		}
+		if len(policy.CanReply.Always) > 0 {
+			params.SetInteractionPolicyCanReplyAlways0(ptr(string(policy.CanReply.Always[0])))
+		}
+		if len(policy.CanReply.WithApproval) > 0 {
+			params.SetInteractionPolicyCanReplyWithApproval0(ptr(string(policy.CanReply.WithApproval[0])))
+		}
+	}
+
+	resp, err := g.gts.Client.Statuses.StatusCreate(
+		params,
+		g.gts.Auth,
+		func(op *runtime.ClientOperation) {
+			op.ConsumesMediaTypes = []string{"multipart/form-data"}
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+// DismissNotifications clears all notifications: GoToSocial has no endpoint
+// for dismissing a single one.
+func (g *gtsBackend) DismissNotifications(ctx context.Context, ids []string) error {
+	_, err := g.gts.Client.Notifications.ClearNotifications(notifications.NewClearNotificationsParams().WithContext(ctx), g.gts.Auth)
+	return err
+}
+
+func (g *gtsBackend) React(ctx context.Context, statusID, emoji string) error {
+	_, err := g.gts.Client.Statuses.StatusFave(statuses.NewStatusFaveParams().WithContext(ctx).WithID(statusID), g.gts.Auth)
+	return err
+}
+
+func (g *gtsBackend) CustomEmojis(ctx context.Context) ([]*models.Emoji, error) {
+	resp, err := g.gts.Client.CustomEmojis.CustomEmojisGet(custom_emojis.NewCustomEmojisGetParams().WithContext(ctx), g.gts.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+func (g *gtsBackend) UploadMedia(ctx context.Context, data []byte, filename, description string) (*models.Attachment, error) {
+	params := media.NewMediaCreateParams().WithContext(ctx).
+		WithAPIVersion("v2").
+		WithFile(runtime.NamedReader(filename, bytes.NewReader(data)))
+	if description != "" {
+		params.SetDescription(&description)
+	}
+	resp, err := g.gts.Client.Media.MediaCreate(params, g.gts.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+func (g *gtsBackend) ThreadContext(ctx context.Context, id string) ([]*models.Status, []*models.Status, error) {
+	resp, err := g.gts.Client.Statuses.ThreadContext(statuses.NewThreadContextParams().WithContext(ctx).WithID(id), g.gts.Auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Payload.Ancestors, resp.Payload.Descendants, nil
+}
+
+// EditStatus uses the API directly, since the SDK has no status edits.
+func (g *gtsBackend) EditStatus(ctx context.Context, status *models.Status, text string) error {
+	return g.gts.API.request(ctx, http.MethodPut, "/api/v1/statuses/"+url.PathEscape(status.ID), map[string]interface{}{
+		"status":       text,
+		"spoiler_text": status.SpoilerText,
+		"sensitive":    status.Sensitive,
+		"language":     status.Language,
+		"content_type": "text/markdown",
+	}, nil)
+}
+
+func (g *gtsBackend) DeleteStatus(ctx context.Context, id string) error {
+	_, err := g.gts.Client.Statuses.StatusDelete(statuses.NewStatusDeleteParams().WithContext(ctx).WithID(id), g.gts.Auth)
+	return err
+}
+
+func (g *gtsBackend) Follow(ctx context.Context, accountID string, notify bool) error {
+	params := accounts.NewAccountFollowParams().WithContext(ctx).WithID(accountID)
+	if notify {
+		params.SetNotify(ptr(true))
+	}
+	_, err := g.gts.Client.Accounts.AccountFollow(params, g.gts.Auth)
+	return err
+}
+
+func (g *gtsBackend) FollowRequests(ctx context.Context, limit int64) ([]*models.Account, error) {
+	resp, err := g.gts.Client.FollowRequests.GetFollowRequests(follow_requests.NewGetFollowRequestsParams().WithContext(ctx).WithLimit(&limit), g.gts.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+func (g *gtsBackend) AuthorizeFollowRequest(ctx context.Context, accountID string) error {
+	_, err := g.gts.Client.FollowRequests.AuthorizeFollowRequest(follow_requests.NewAuthorizeFollowRequestParams().WithContext(ctx).WithAccountID(accountID), g.gts.Auth)
+	return err
+}
+
+func (g *gtsBackend) SearchAccount(ctx context.Context, acct string) (*models.Account, error) {
+	resp, err := g.search(ctx, "@"+acct, "accounts")
+	if err != nil || len(resp.Accounts) == 0 {
+		return nil, err
+	}
+	return resp.Accounts[0], nil
+}
+
+func (g *gtsBackend) SearchStatus(ctx context.Context, link string) (*models.Status, error) {
+	resp, err := g.search(ctx, link, "statuses")
+	if err != nil || len(resp.Statuses) == 0 {
+		return nil, err
+	}
+	return resp.Statuses[0], nil
+}
+
+// search returns the first result of the given type for q, resolving it on
+// its server if it is not known yet.
+func (g *gtsBackend) search(ctx context.Context, q, resultType string) (*models.SearchResult, error) {
+	limit := int64(1)
+	params := search.NewSearchGetParams().WithContext(ctx).
+		WithAPIVersion("v2").
+		WithQ(q).
+		WithResolve(ptr(true)).
+		WithType(&resultType).
+		WithLimit(&limit)
+	resp, err := g.gts.Client.Search.SearchGet(params, g.gts.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+// QuotedStatus reads the quote fields with a plain request, since the SDK's
+// status model drops them.
+func (g *gtsBackend) QuotedStatus(ctx context.Context, status *models.Status) (*models.Status, error) {
+	return fetchQuote(ctx, g.gts.API, status.ID, g.GetStatus)
+}
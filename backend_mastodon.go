@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// pleromaReactionType is the notification type of emoji reactions on Akkoma and Pleroma.
+const pleromaReactionType = "pleroma:emoji_reaction"
+
+// mastodonBackend talks to servers implementing the Mastodon client API,
+// such as Mastodon itself, Akkoma and Pleroma, with plain JSON requests.
+type mastodonBackend struct {
+	api *apiClient
+}
+
+func (m *mastodonBackend) VerifyCredentials(ctx context.Context) (*models.Account, error) {
+	var account models.Account
+	if err := m.api.request(ctx, http.MethodGet, "/api/v1/accounts/verify_credentials", nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (m *mastodonBackend) Notifications(ctx context.Context, query NotificationQuery) ([]*models.Notification, error) {
+	values := url.Values{}
+	if query.Limit > 0 {
+		values.Set("limit", strconv.FormatInt(query.Limit, 10))
+	}
+	if query.MinID != "" {
+		values.Set("min_id", query.MinID)
+	}
+	for _, t := range query.Types {
+		if t == reactionType {
+			t = pleromaReactionType
+		}
+		values.Add("types[]", t)
+	}
+	var notifs []struct {
+		models.Notification
+		Emoji string `json:"emoji"`
+	}
+	if err := m.api.request(ctx, http.MethodGet, "/api/v1/notifications?"+values.Encode(), nil, &notifs); err != nil {
+		return nil, err
+	}
+	out := make([]*models.Notification, len(notifs))
+	for i := range notifs {
+		out[i] = &notifs[i].Notification
+		if out[i].Type == pleromaReactionType {
+			out[i].Type = reactionType + ":" + notifs[i].Emoji
+		}
+	}
+	return out, nil
+}
+
+func (m *mastodonBackend) GetStatus(ctx context.Context, id string) (*models.Status, error) {
+	var status models.Status
+	if err := m.api.request(ctx, http.MethodGet, "/api/v1/statuses/"+url.PathEscape(id), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (m *mastodonBackend) PostStatus(ctx context.Context, post *StatusPost) (*models.Status, error) {
+	body := map[string]interface{}{
+		"status":     post.Text,
+		"visibility": post.Visibility,
+		"sensitive":  post.Sensitive,
+	}
+	if post.ContentType != "" {
+		// Akkoma and Pleroma render Markdown; Mastodon ignores this.
+		body["content_type"] = post.ContentType
+	}
+	if post.InReplyToID != "" {
+		body["in_reply_to_id"] = post.InReplyToID
+	}
+	if post.Language != "" {
+		body["language"] = post.Language
+	}
+	if post.SpoilerText != "" {
+		body["spoiler_text"] = post.SpoilerText
+	}
+	if len(post.MediaIDs) > 0 {
+		body["media_ids"] = post.MediaIDs
+	}
+	if poll := post.Poll; poll != nil {
+		body["poll"] = map[string]interface{}{
+			"options":    poll.Options,
+			"expires_in": poll.ExpiresIn,
+			"multiple":   poll.Multiple,
+		}
+	}
+
+	var status models.Status
+	if err := m.api.request(ctx, http.MethodPost, "/api/v1/statuses", body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (m *mastodonBackend) DismissNotifications(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		if err := m.api.request(ctx, http.MethodPost, fmt.Sprintf("/api/v1/notifications/%s/dismiss", url.PathEscape(id)), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mastodonBackend) React(ctx context.Context, statusID, emoji string) error {
+	if emoji == "" {
+		return m.api.request(ctx, http.MethodPost, "/api/v1/statuses/"+url.PathEscape(statusID)+"/favourite", nil, nil)
+	}
+	return m.api.request(ctx, http.MethodPut, "/api/v1/pleroma/statuses/"+url.PathEscape(statusID)+"/reactions/"+url.PathEscape(emoji), nil, nil)
+}
+
+func (m *mastodonBackend) CustomEmojis(ctx context.Context) ([]*models.Emoji, error) {
+	var emojis []*models.Emoji
+	if err := m.api.request(ctx, http.MethodGet, "/api/v1/custom_emojis", nil, &emojis); err != nil {
+		return nil, err
+	}
+	return emojis, nil
+}
+
+func (m *mastodonBackend) UploadMedia(ctx context.Context, data []byte, filename, description string) (*models.Attachment, error) {
+	fields := map[string]string{}
+	if description != "" {
+		fields["description"] = description
+	}
+	var attachment models.Attachment
+	if err := m.api.upload(ctx, "/api/v2/media", fields, filename, data, &attachment); err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+func (m *mastodonBackend) ThreadContext(ctx context.Context, id string) ([]*models.Status, []*models.Status, error) {
+	var thread models.ThreadContext
+	if err := m.api.request(ctx, http.MethodGet, "/api/v1/statuses/"+url.PathEscape(id)+"/context", nil, &thread); err != nil {
+		return nil, nil, err
+	}
+	return thread.Ancestors, thread.Descendants, nil
+}
+
+func (m *mastodonBackend) EditStatus(ctx context.Context, status *models.Status, text string) error {
+	return m.api.request(ctx, http.MethodPut, "/api/v1/statuses/"+url.PathEscape(status.ID), map[string]interface{}{
+		"status":       text,
+		"spoiler_text": status.SpoilerText,
+		"sensitive":    status.Sensitive,
+		"language":     status.Language,
+		"content_type": "text/markdown",
+	}, nil)
+}
+
+func (m *mastodonBackend) DeleteStatus(ctx context.Context, id string) error {
+	return m.api.request(ctx, http.MethodDelete, "/api/v1/statuses/"+url.PathEscape(id), nil, nil)
+}
+
+func (m *mastodonBackend) Follow(ctx context.Context, accountID string, notify bool) error {
+	return m.api.request(ctx, http.MethodPost, "/api/v1/accounts/"+url.PathEscape(accountID)+"/follow", map[string]interface{}{"notify": notify}, nil)
+}
+
+func (m *mastodonBackend) FollowRequests(ctx context.Context, limit int64) ([]*models.Account, error) {
+	var accounts []*models.Account
+	if err := m.api.request(ctx, http.MethodGet, "/api/v1/follow_requests?limit="+strconv.FormatInt(limit, 10), nil, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func (m *mastodonBackend) AuthorizeFollowRequest(ctx context.Context, accountID string) error {
+	return m.api.request(ctx, http.MethodPost, "/api/v1/follow_requests/"+url.PathEscape(accountID)+"/authorize", nil, nil)
+}
+
+func (m *mastodonBackend) SearchAccount(ctx context.Context, acct string) (*models.Account, error) {
+	result, err := m.search(ctx, "@"+acct, "accounts")
+	if err != nil || len(result.Accounts) == 0 {
+		return nil, err
+	}
+	return result.Accounts[0], nil
+}
+
+func (m *mastodonBackend) SearchStatus(ctx context.Context, link string) (*models.Status, error) {
+	result, err := m.search(ctx, link, "statuses")
+	if err != nil || len(result.Statuses) == 0 {
+		return nil, err
+	}
+	return result.Statuses[0], nil
+}
+
+// search returns the first result of the given type for q, resolving it on
+// its server if it is not known yet.
+func (m *mastodonBackend) search(ctx context.Context, q, resultType string) (*models.SearchResult, error) {
+	values := url.Values{"q": {q}, "resolve": {"true"}, "type": {resultType}, "limit": {"1"}}
+	var result models.SearchResult
+	if err := m.api.request(ctx, http.MethodGet, "/api/v2/search?"+values.Encode(), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (m *mastodonBackend) QuotedStatus(ctx context.Context, status *models.Status) (*models.Status, error) {
+	return fetchQuote(ctx, m.api, status.ID, m.GetStatus)
+}
+
+// quoteFields are the fields servers use to embed or reference a quoted
+// status, which the SDK's status model does not include.
+type quoteFields struct {
+	Quote   json.RawMessage `json:"quote"`
+	QuoteID string          `json:"quote_id"`
+	Pleroma struct {
+		Quote   *models.Status `json:"quote"`
+		QuoteID string         `json:"quote_id"`
+	} `json:"pleroma"`
+}
+
+// fetchQuote returns the status quoted by the status with id, going by the
+// quote fields of Mastodon, Akkoma and Pleroma. A quoted status that is only
+// referenced is fetched with get.
+func fetchQuote(ctx context.Context, api *apiClient, id string, get func(context.Context, string) (*models.Status, error)) (*models.Status, error) {
+	var fields quoteFields
+	if err := api.request(ctx, http.MethodGet, "/api/v1/statuses/"+url.PathEscape(id), nil, &fields); err != nil {
+		return nil, err
+	}
+
+	// Mastodon wraps the quoted status; Akkoma and Pleroma embed it directly.
+	var wrapped struct {
+		QuotedStatus   *models.Status `json:"quoted_status"`
+		QuotedStatusID string         `json:"quoted_status_id"`
+	}
+	var embedded models.Status
+	if len(fields.Quote) > 0 && json.Unmarshal(fields.Quote, &wrapped) == nil && wrapped.QuotedStatus != nil {
+		return wrapped.QuotedStatus, nil
+	}
+	if len(fields.Quote) > 0 && json.Unmarshal(fields.Quote, &embedded) == nil && embedded.ID != "" {
+		return &embedded, nil
+	}
+	if fields.Pleroma.Quote != nil {
+		return fields.Pleroma.Quote, nil
+	}
+	for _, quoteID := range []string{wrapped.QuotedStatusID, fields.QuoteID, fields.Pleroma.QuoteID} {
+		if quoteID != "" {
+			return get(ctx, quoteID)
+		}
+	}
+	return nil, nil
+}
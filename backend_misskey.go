@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// misskeyBackend talks to Misskey and its forks (Sharkey, Firefish, ...)
+// through the Misskey API, converting notes and users to Mastodon API shapes.
+type misskeyBackend struct {
+	api *apiClient
+}
+
+type misskeyUser struct {
+	ID       string  `json:"id"`
+	Username string  `json:"username"`
+	Host     *string `json:"host"`
+	Name     *string `json:"name"`
+	IsBot    bool    `json:"isBot"`
+	IsLocked bool    `json:"isLocked"`
+	URL      *string `json:"url"`
+}
+
+type misskeyFile struct {
+	ID           string  `json:"id"`
+	Type         string  `json:"type"`
+	URL          string  `json:"url"`
+	ThumbnailURL *string `json:"thumbnailUrl"`
+	Comment      *string `json:"comment"`
+	IsSensitive  bool    `json:"isSensitive"`
+}
+
+type misskeyNote struct {
+	ID           string        `json:"id"`
+	CreatedAt    string        `json:"createdAt"`
+	Text         *string       `json:"text"`
+	CW           *string       `json:"cw"`
+	User         misskeyUser   `json:"user"`
+	ReplyID      *string       `json:"replyId"`
+	Renote       *misskeyNote  `json:"renote"`
+	RepliesCount int64         `json:"repliesCount"`
+	Visibility   string        `json:"visibility"`
+	LocalOnly    bool          `json:"localOnly"`
+	URL          *string       `json:"url"`
+	URI          *string       `json:"uri"`
+	Files        []misskeyFile `json:"files"`
+	Poll         *struct {
+		Multiple  bool    `json:"multiple"`
+		ExpiresAt *string `json:"expiresAt"`
+		Choices   []struct {
+			Text  string `json:"text"`
+			Votes int64  `json:"votes"`
+		} `json:"choices"`
+	} `json:"poll"`
+}
+
+type misskeyNotification struct {
+	ID        string       `json:"id"`
+	CreatedAt string       `json:"createdAt"`
+	Type      string       `json:"type"`
+	User      *misskeyUser `json:"user"`
+	Note      *misskeyNote `json:"note"`
+	Reaction  string       `json:"reaction"`
+}
+
+// misskeyNotificationTypes maps Mastodon notification types to Misskey's.
+// Replies to the bot's notes are notified as replies rather than mentions.
+var misskeyNotificationTypes = map[string][]string{
+	"mention":        {"mention", "reply"},
+	"follow":         {"follow"},
+	"follow_request": {"receiveFollowRequest"},
+	"status":         {"note"},
+	reactionType:     {"reaction"},
+}
+
+// misskeyLike is the reaction used in place of a favourite.
+const misskeyLike = "👍"
+
+var misskeyVisibility = map[string]string{
+	"public":   "public",
+	"unlisted": "home",
+	"private":  "followers",
+	"direct":   "specified",
+}
+
+var misskeyMentionRe = regexp.MustCompile(`(?:^|[^\w@])@(\w[\w.-]*)(?:@([\w.-]+\w))?`)
+
+// errMisskeyEdit is returned for status edits, which Misskey does not have.
+var errMisskeyEdit = fmt.Errorf("%w: Misskey cannot edit notes", errors.ErrUnsupported)
+
+func (m *misskeyBackend) VerifyCredentials(ctx context.Context) (*models.Account, error) {
+	var user misskeyUser
+	if err := m.api.request(ctx, http.MethodPost, "/api/i", map[string]interface{}{}, &user); err != nil {
+		return nil, err
+	}
+	return m.account(&user), nil
+}
+
+func (m *misskeyBackend) Notifications(ctx context.Context, query NotificationQuery) ([]*models.Notification, error) {
+	body := map[string]interface{}{}
+	if query.Limit > 0 {
+		body["limit"] = min(query.Limit, 100)
+	}
+	if query.MinID != "" {
+		body["sinceId"] = query.MinID
+	}
+	if len(query.Types) > 0 {
+		var types []string
+		for _, t := range query.Types {
+			types = append(types, misskeyNotificationTypes[t]...)
+		}
+		body["includeTypes"] = types
+	}
+
+	var notifs []misskeyNotification
+	if err := m.api.request(ctx, http.MethodPost, "/api/i/notifications", body, &notifs); err != nil {
+		return nil, err
+	}
+	// Depending on the version, pages with sinceId come oldest first.
+	sort.SliceStable(notifs, func(i, j int) bool { return notifs[i].CreatedAt > notifs[j].CreatedAt })
+
+	var out []*models.Notification
+	for _, n := range notifs {
+		notif := &models.Notification{ID: n.ID, CreatedAt: n.CreatedAt}
+		for t, misskeyTypes := range misskeyNotificationTypes {
+			for _, mt := range misskeyTypes {
+				if mt == n.Type {
+					notif.Type = t
+				}
+			}
+		}
+		if notif.Type == "" {
+			continue
+		}
+		if notif.Type == reactionType {
+			notif.Type += ":" + n.Reaction
+		}
+		if n.User != nil {
+			notif.Account = m.account(n.User)
+		}
+		if n.Note != nil {
+			notif.Status = m.status(n.Note)
+		}
+		out = append(out, notif)
+	}
+	return out, nil
+}
+
+func (m *misskeyBackend) GetStatus(ctx context.Context, id string) (*models.Status, error) {
+	var note misskeyNote
+	if err := m.api.request(ctx, http.MethodPost, "/api/notes/show", map[string]interface{}{"noteId": id}, &note); err != nil {
+		return nil, err
+	}
+	return m.status(&note), nil
+}
+
+// PostStatus creates a note. Direct notes are visible to the users they
+// mention; Misskey has no post language or interaction policies.
+func (m *misskeyBackend) PostStatus(ctx context.Context, post *StatusPost) (*models.Status, error) {
+	visibility, ok := misskeyVisibility[post.Visibility]
+	if !ok {
+		visibility = "specified"
+	}
+	body := map[string]interface{}{
+		"text":       post.Text,
+		"visibility": visibility,
+		"localOnly":  post.LocalOnly,
+	}
+	if post.InReplyToID != "" {
+		body["replyId"] = post.InReplyToID
+	}
+	if post.SpoilerText != "" {
+		body["cw"] = post.SpoilerText
+	}
+	if len(post.MediaIDs) > 0 {
+		body["fileIds"] = post.MediaIDs
+	}
+	if poll := post.Poll; poll != nil {
+		body["poll"] = map[string]interface{}{
+			"choices":      poll.Options,
+			"multiple":     poll.Multiple,
+			"expiredAfter": poll.ExpiresIn * 1000,
+		}
+	}
+
+	var resp struct {
+		CreatedNote misskeyNote `json:"createdNote"`
+	}
+	if err := m.api.request(ctx, http.MethodPost, "/api/notes/create", body, &resp); err != nil {
+		return nil, err
+	}
+	return m.status(&resp.CreatedNote), nil
+}
+
+// DismissNotifications deletes all notifications: Misskey can only mark
+// single ones as read, which would not stop them from being handled again.
+func (m *misskeyBackend) DismissNotifications(ctx context.Context, ids []string) error {
+	return m.api.request(ctx, http.MethodPost, "/api/notifications/flush", map[string]interface{}{}, nil)
+}
+
+func (m *misskeyBackend) React(ctx context.Context, statusID, emoji string) error {
+	if emoji == "" {
+		emoji = misskeyLike
+	}
+	return m.api.request(ctx, http.MethodPost, "/api/notes/reactions/create", map[string]interface{}{"noteId": statusID, "reaction": emoji}, nil)
+}
+
+// CustomEmojis lists the server's emoji, which are all offered in Misskey's picker.
+func (m *misskeyBackend) CustomEmojis(ctx context.Context) ([]*models.Emoji, error) {
+	var resp struct {
+		Emojis []struct {
+			Name     string  `json:"name"`
+			Category *string `json:"category"`
+			URL      string  `json:"url"`
+		} `json:"emojis"`
+	}
+	if err := m.api.request(ctx, http.MethodPost, "/api/emojis", map[string]interface{}{}, &resp); err != nil {
+		return nil, err
+	}
+	emojis := make([]*models.Emoji, 0, len(resp.Emojis))
+	for _, e := range resp.Emojis {
+		emoji := &models.Emoji{Shortcode: e.Name, URL: e.URL, StaticURL: e.URL, VisibleInPicker: true}
+		if e.Category != nil {
+			emoji.Category = *e.Category
+		}
+		emojis = append(emojis, emoji)
+	}
+	return emojis, nil
+}
+
+func (m *misskeyBackend) UploadMedia(ctx context.Context, data []byte, filename, description string) (*models.Attachment, error) {
+	fields := map[string]string{"name": filename}
+	if description != "" {
+		fields["comment"] = description
+	}
+	var file misskeyFile
+	if err := m.api.upload(ctx, "/api/drive/files/create", fields, filename, data, &file); err != nil {
+		return nil, err
+	}
+	return misskeyAttachment(&file), nil
+}
+
+func (m *misskeyBackend) account(user *misskeyUser) *models.Account {
+	account := &models.Account{
+		ID:       user.ID,
+		Username: user.Username,
+		Acct:     user.Username,
+		Bot:      user.IsBot,
+		Locked:   user.IsLocked,
+		URL:      fmt.Sprintf("https://%s/@%s", m.api.domain, user.Username),
+	}
+	if user.Host != nil {
+		account.Acct += "@" + *user.Host
+	}
+	if user.Name != nil {
+		account.DisplayName = *user.Name
+	}
+	if user.URL != nil {
+		account.URL = *user.URL
+	}
+	return account
+}
+
+func (m *misskeyBackend) status(note *misskeyNote) *models.Status {
+	status := &models.Status{
+		ID:           note.ID,
+		CreatedAt:    note.CreatedAt,
+		Account:      m.account(&note.User),
+		LocalOnly:    note.LocalOnly,
+		RepliesCount: note.RepliesCount,
+		URL:          fmt.Sprintf("https://%s/notes/%s", m.api.domain, note.ID),
+	}
+	for mastodon, misskey := range misskeyVisibility {
+		if misskey == note.Visibility {
+			status.Visibility = mastodon
+		}
+	}
+	if note.Text != nil {
+		// The MFM source is used as is, like a local status's text.
+		status.Text = *note.Text
+	}
+	if note.CW != nil {
+		status.SpoilerText = *note.CW
+	}
+	if note.ReplyID != nil {
+		status.InReplyToID = *note.ReplyID
+	}
+	if note.URL != nil {
+		status.URL = *note.URL
+	} else if note.URI != nil {
+		status.URL = *note.URI
+	}
+
+	for _, match := range misskeyMentionRe.FindAllStringSubmatch(status.Text, -1) {
+		mention := &models.Mention{Username: match[1], Acct: match[1]}
+		if match[2] != "" && !strings.EqualFold(match[2], m.api.domain) {
+			mention.Acct += "@" + match[2]
+			mention.URL = fmt.Sprintf("https://%s/@%s", match[2], match[1])
+		}
+		status.Mentions = append(status.Mentions, mention)
+	}
+
+	for i := range note.Files {
+		status.MediaAttachments = append(status.MediaAttachments, misskeyAttachment(&note.Files[i]))
+		status.Sensitive = status.Sensitive || note.Files[i].IsSensitive
+	}
+
+	if note.Poll != nil {
+		poll := &models.Poll{Multiple: note.Poll.Multiple}
+		for _, choice := range note.Poll.Choices {
+			poll.Options = append(poll.Options, &models.PollOption{Title: choice.Text, VotesCount: choice.Votes})
+			poll.VotesCount += choice.Votes
+		}
+		if note.Poll.ExpiresAt != nil {
+			poll.ExpiresAt = *note.Poll.ExpiresAt
+			if t, err := time.Parse(time.RFC3339, poll.ExpiresAt); err == nil {
+				poll.Expired = t.Before(time.Now())
+			}
+		}
+		status.Poll = poll
+	}
+	return status
+}
+
+func misskeyAttachment(file *misskeyFile) *models.Attachment {
+	attachment := &models.Attachment{ID: file.ID, URL: file.URL, Type: "unknown"}
+	switch {
+	case strings.HasPrefix(file.Type, "image/"):
+		attachment.Type = "image"
+	case strings.HasPrefix(file.Type, "video/"):
+		attachment.Type = "video"
+	case strings.HasPrefix(file.Type, "audio/"):
+		attachment.Type = "audio"
+	}
+	if file.ThumbnailURL != nil {
+		attachment.PreviewURL = *file.ThumbnailURL
+	}
+	if file.Comment != nil {
+		attachment.Description = *file.Comment
+	}
+	return attachment
+}
+
+// ThreadContext returns the notes replied to and the direct replies, which
+// are all the bot looks for among the descendants.
+func (m *misskeyBackend) ThreadContext(ctx context.Context, id string) ([]*models.Status, []*models.Status, error) {
+	var parents, children []misskeyNote
+	if err := m.api.request(ctx, http.MethodPost, "/api/notes/conversation", map[string]interface{}{"noteId": id, "limit": 100}, &parents); err != nil {
+		return nil, nil, err
+	}
+	if err := m.api.request(ctx, http.MethodPost, "/api/notes/children", map[string]interface{}{"noteId": id, "limit": 100}, &children); err != nil {
+		return nil, nil, err
+	}
+	// The conversation starts with the parent.
+	ancestors := make([]*models.Status, len(parents))
+	for i := range parents {
+		ancestors[len(parents)-1-i] = m.status(&parents[i])
+	}
+	var descendants []*models.Status
+	for i := range children {
+		// Children include quotes.
+		if children[i].ReplyID != nil && *children[i].ReplyID == id {
+			descendants = append(descendants, m.status(&children[i]))
+		}
+	}
+	return ancestors, descendants, nil
+}
+
+func (m *misskeyBackend) EditStatus(ctx context.Context, status *models.Status, text string) error {
+	return errMisskeyEdit
+}
+
+func (m *misskeyBackend) DeleteStatus(ctx context.Context, id string) error {
+	return m.api.request(ctx, http.MethodPost, "/api/notes/delete", map[string]interface{}{"noteId": id}, nil)
+}
+
+// Follow follows a user, if not already, and turns on notifications of its
+// new notes with notify.
+func (m *misskeyBackend) Follow(ctx context.Context, accountID string, notify bool) error {
+	err := m.api.request(ctx, http.MethodPost, "/api/following/create", map[string]interface{}{"userId": accountID}, nil)
+	if err != nil && !strings.Contains(err.Error(), "ALREADY_FOLLOWING") {
+		return err
+	}
+	if !notify {
+		return nil
+	}
+	return m.api.request(ctx, http.MethodPost, "/api/following/update", map[string]interface{}{"userId": accountID, "notify": "normal"}, nil)
+}
+
+func (m *misskeyBackend) FollowRequests(ctx context.Context, limit int64) ([]*models.Account, error) {
+	var requests []struct {
+		Follower misskeyUser `json:"follower"`
+	}
+	if err := m.api.request(ctx, http.MethodPost, "/api/following/requests/list", map[string]interface{}{"limit": min(limit, 100)}, &requests); err != nil {
+		return nil, err
+	}
+	accounts := make([]*models.Account, len(requests))
+	for i := range requests {
+		accounts[i] = m.account(&requests[i].Follower)
+	}
+	return accounts, nil
+}
+
+func (m *misskeyBackend) AuthorizeFollowRequest(ctx context.Context, accountID string) error {
+	return m.api.request(ctx, http.MethodPost, "/api/following/requests/accept", map[string]interface{}{"userId": accountID}, nil)
+}
+
+// SearchAccount looks the user up by username and host, which makes the
+// server fetch remote users it does not know yet.
+func (m *misskeyBackend) SearchAccount(ctx context.Context, acct string) (*models.Account, error) {
+	username, host, _ := strings.Cut(strings.TrimPrefix(acct, "@"), "@")
+	body := map[string]interface{}{"username": username}
+	if host != "" && !strings.EqualFold(host, m.api.domain) {
+		body["host"] = host
+	}
+	var user misskeyUser
+	if err := m.api.request(ctx, http.MethodPost, "/api/users/show", body, &user); err != nil {
+		if strings.Contains(err.Error(), "NO_SUCH_USER") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m.account(&user), nil
+}
+
+// SearchStatus resolves the link through ActivityPub, fetching the note
+// from its server if it is not known yet.
+func (m *misskeyBackend) SearchStatus(ctx context.Context, link string) (*models.Status, error) {
+	var resp struct {
+		Type   string          `json:"type"`
+		Object json.RawMessage `json:"object"`
+	}
+	if err := m.api.request(ctx, http.MethodPost, "/api/ap/show", map[string]interface{}{"uri": link}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Type != "Note" {
+		return nil, nil
+	}
+	var note misskeyNote
+	if err := json.Unmarshal(resp.Object, &note); err != nil {
+		return nil, err
+	}
+	return m.status(&note), nil
+}
+
+// QuotedStatus returns the renote of a note with text of its own; a renote
+// without text is a boost.
+func (m *misskeyBackend) QuotedStatus(ctx context.Context, status *models.Status) (*models.Status, error) {
+	var note misskeyNote
+	if err := m.api.request(ctx, http.MethodPost, "/api/notes/show", map[string]interface{}{"noteId": status.ID}, &note); err != nil {
+		return nil, err
+	}
+	if note.Renote == nil || note.Text == nil {
+		return nil, nil
+	}
+	return m.status(note.Renote), nil
+}
+
+// restrict turns off streamed replies, which are edited as they are
+// generated.
+func (m *misskeyBackend) restrict(config *Config) {
+	if config.StreamReplies {
+		log.Println("STREAM_REPLIES is turned off: Misskey cannot edit notes")
+		config.StreamReplies = false
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const blockedFile = "blocked.json"
+
+// blockList holds the accounts whose notifications the bot ignores, with the
+// time each was blocked.
+type blockList struct {
+	mu       sync.Mutex
+	dir      dataDir
+	Accounts map[string]time.Time `json:"accounts"`
+}
+
+func newBlockList(dir dataDir) *blockList {
+	l := &blockList{dir: dir}
+	if err := dir.load(blockedFile, l); err != nil {
+		log.Printf("Failed to load blocked accounts: %v", err)
+	}
+	if l.Accounts == nil {
+		l.Accounts = map[string]time.Time{}
+	}
+	return l
+}
+
+func (l *blockList) reset() {
+	l.Accounts = map[string]time.Time{}
+}
+
+func (l *blockList) blocked(acct string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.dir.sync(blockedFile, l, l.reset)()
+
+	_, ok := l.Accounts[acct]
+	return ok
+}
+
+func (l *blockList) block(acct string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.dir.sync(blockedFile, l, l.reset)()
+
+	if _, ok := l.Accounts[acct]; ok {
+		return
+	}
+	l.Accounts[acct] = time.Now()
+	l.save()
+}
+
+func (l *blockList) unblock(acct string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.dir.sync(blockedFile, l, l.reset)()
+
+	delete(l.Accounts, acct)
+	l.save()
+}
+
+// list returns the blocked accounts in alphabetical order.
+func (l *blockList) list() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.dir.sync(blockedFile, l, l.reset)()
+
+	accts := make([]string, 0, len(l.Accounts))
+	for acct := range l.Accounts {
+		accts = append(accts, acct)
+	}
+	sort.Strings(accts)
+	return accts
+}
+
+func (l *blockList) save() {
+	if err := l.dir.save(blockedFile, l); err != nil {
+		log.Printf("Failed to save blocked accounts: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Bot holds the configuration, API clients and persistent state of a running
+// bot. Config, clients and catalog are read-only after newBot; the stores
+// synchronize access to their own mutable state, so a Bot is safe to share
+// between goroutines.
+type Bot struct {
+	config        Config
+	backend       Backend
+	openAI        *http.Client
+	media         *http.Client
+	links         *http.Client
+	catalog       Catalog
+	usage         *usageStore
+	personas      *personaStore
+	cursor        *pollCursor
+	archive       *archive
+	declined      *declinedThreads
+	replies       *replyLog
+	outbox        *outbox
+	blocked       *blockList
+	spam          *spamGuard
+	recent        *recentReplies
+	emojis        *emojiCache
+	jobs          *jobQueue
+	lastPoll      lastPoll
+	started       time.Time
+	schedules     []*Schedule
+	feeds         []*Feed
+	feedState     *feedState
+	subscriptions []*Subscription
+	// limiter paces requests to the server; the debug endpoint shows it.
+	limiter *rate.Limiter
+	// tasks tracks background work that shutdown waits for.
+	tasks sync.WaitGroup
+}
+
+func newBot(config Config) *Bot {
+	gts, openAI, media := newClients(config)
+	backend := newBackend(config, gts)
+	if r, ok := backend.(restrictedBackend); ok {
+		r.restrict(&config)
+	}
+	if config.DryRun {
+		log.Println("Dry run: nothing will be posted, dismissed or saved")
+		backend = &dryRunBackend{Backend: backend}
+	}
+	var jobs *jobQueue
+	if config.QueueURL != "" {
+		var err error
+		if jobs, err = newJobQueue(config.QueueURL, config.QueueName); err != nil {
+			log.Fatal(err)
+		}
+	}
+	data := dataDir{path: config.DataDir, readOnly: config.DryRun}
+	if jobs != nil {
+		data.shared = newSharedState(jobs.redis.clone(), config.QueueName)
+	}
+	return &Bot{
+		config:        config,
+		backend:       backend,
+		openAI:        openAI,
+		media:         media,
+		links:         newLinkClient(config.LinkTimeout),
+		catalog:       loadCatalog(config.LangDir, config.DefaultLanguage),
+		usage:         newUsageStore(data),
+		personas:      newPersonaStore(config.PersonasFile, data),
+		cursor:        newPollCursor(data),
+		archive:       newArchive(data),
+		declined:      newDeclinedThreads(data),
+		replies:       newReplyLog(data),
+		outbox:        newOutbox(data),
+		blocked:       newBlockList(data),
+		spam:          newSpamGuard(data),
+		recent:        &recentReplies{},
+		emojis:        &emojiCache{},
+		jobs:          jobs,
+		started:       time.Now(),
+		schedules:     loadSchedules(config.SchedulesFile),
+		feeds:         loadFeeds(config.FeedsFile),
+		feedState:     newFeedState(data),
+		subscriptions: loadSubscriptions(config.SubscriptionsFile),
+		limiter:       gts.limiter,
+	}
+}
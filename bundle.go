@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	bundleVersion = 1
+	// bundleEnvFile holds imported settings, applied below the environment and .env.
+	bundleEnvFile = "bundle.env"
+)
+
+// Settings left out of bundles: secrets, and values tied to one deployment.
+var unbundledSettings = map[string]bool{
+	"OPENAI_API_KEY":     true,
+	"CLIENT_KEY":         true,
+	"CLIENT_SECRET":      true,
+	"ACCESS_TOKEN":       true,
+	"FEDI_DOMAIN":        true,
+	"BACKEND":            true,
+	"BOT_ACCOUNT_NAME":   true,
+	"DATA_DIR":           true,
+	"LANG_DIR":           true,
+	"PERSONAS_FILE":      true,
+	"SCHEDULES_FILE":     true,
+	"FEEDS_FILE":         true,
+	"SUBSCRIPTIONS_FILE": true,
+	"DRY_RUN":            true,
+	"DRY_RUN_REPLY":      true,
+	// Proxy URLs may carry credentials.
+	"GTS_PROXY":                true,
+	"GTS_CA_FILE":              true,
+	"GTS_INSECURE_SKIP_VERIFY": true,
+	"LLM_PROXY":                true,
+	"LLM_CA_FILE":              true,
+	"LLM_INSECURE_SKIP_VERIFY": true,
+	"DASHBOARD_ADDR":           true,
+	"DASHBOARD_TOKEN":          true,
+	"DEBUG_ADDR":               true,
+	"DEBUG_TOKEN":              true,
+	"EXPORT_DIR":               true,
+	"EXPORT_URL":               true,
+	"QUEUE_URL":                true,
+	// The endpoints the API keys are sent to, so that an imported bundle
+	// cannot send them elsewhere.
+	"OPENAI_API_URL":  true,
+	"OPENAI_PROVIDER": true,
+	"MODERATION_URL":  true,
+}
+
+// isBundled reports whether a setting belongs in bundles. The API keys of
+// named providers are secrets too, and their URLs are where the keys go.
+func isBundled(key string) bool {
+	if unbundledSettings[key] {
+		return false
+	}
+	if strings.HasPrefix(key, "PROVIDER_") {
+		return !strings.HasSuffix(key, "_KEY") && !strings.HasSuffix(key, "_URL") && !strings.HasSuffix(key, "_TYPE")
+	}
+	return true
+}
+
+// bundledDataFiles are the files in DATA_DIR that carry configuration rather than history.
+var bundledDataFiles = []string{personaSelectionsFile}
+
+// Bundle is a portable snapshot of a bot's configuration, without secrets.
+type Bundle struct {
+	Version       int                        `json:"version"`
+	Settings      map[string]string          `json:"settings"`
+	Personas      json.RawMessage            `json:"personas,omitempty"`
+	Schedules     json.RawMessage            `json:"schedules,omitempty"`
+	Feeds         json.RawMessage            `json:"feeds,omitempty"`
+	Subscriptions json.RawMessage            `json:"subscriptions,omitempty"`
+	Data          map[string]json.RawMessage `json:"data,omitempty"`
+}
+
+// exportBundle collects the settings currently in effect, the personas,
+// schedules, feeds and subscriptions, and the bundled data files.
+func exportBundle(config Config) (*Bundle, error) {
+	bundle := &Bundle{Version: bundleVersion, Settings: map[string]string{}, Data: map[string]json.RawMessage{}}
+	for _, key := range configKeys() {
+		if value := os.Getenv(key); value != "" && isBundled(key) {
+			bundle.Settings[key] = value
+		}
+	}
+
+	for _, f := range []struct {
+		file string
+		data *json.RawMessage
+	}{
+		{config.PersonasFile, &bundle.Personas},
+		{config.SchedulesFile, &bundle.Schedules},
+		{config.FeedsFile, &bundle.Feeds},
+		{config.SubscriptionsFile, &bundle.Subscriptions},
+	} {
+		if f.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.file)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.file, err)
+		}
+		*f.data = data
+	}
+
+	for _, name := range bundledDataFiles {
+		var data json.RawMessage
+		if err := loadJSON(config.DataDir, name, &data); err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		if data != nil {
+			bundle.Data[name] = data
+		}
+	}
+	return bundle, nil
+}
+
+// importBundle writes a bundle's settings to DATA_DIR/bundle.env and its
+// personas, schedules, feeds, subscriptions and data files into place, and
+// returns the settings written and those skipped as not bundled. Settings
+// take effect on the next start.
+func importBundle(config Config, bundle *Bundle) (written, skipped []string, err error) {
+	if bundle.Version != bundleVersion {
+		return nil, nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	if err := os.MkdirAll(config.DataDir, 0o755); err != nil {
+		return nil, nil, err
+	}
+
+	settings := map[string]string{}
+	for key, value := range bundle.Settings {
+		if isBundled(key) {
+			settings[key] = value
+		} else {
+			skipped = append(skipped, key)
+		}
+	}
+
+	for _, f := range []struct {
+		data json.RawMessage
+		file string
+		key  string
+		name string
+	}{
+		{bundle.Personas, config.PersonasFile, "PERSONAS_FILE", "personas.json"},
+		{bundle.Schedules, config.SchedulesFile, "SCHEDULES_FILE", "schedules.json"},
+		{bundle.Feeds, config.FeedsFile, "FEEDS_FILE", "feeds.json"},
+		{bundle.Subscriptions, config.SubscriptionsFile, "SUBSCRIPTIONS_FILE", "subscriptions.json"},
+	} {
+		if f.data == nil {
+			continue
+		}
+		file := f.file
+		if file == "" {
+			file = filepath.Join(config.DataDir, f.name)
+			settings[f.key] = file
+		}
+		if err := os.WriteFile(file, f.data, 0o600); err != nil {
+			return nil, nil, fmt.Errorf("write %s: %w", file, err)
+		}
+	}
+
+	for _, name := range bundledDataFiles {
+		if data, ok := bundle.Data[name]; ok {
+			if err := saveJSON(config.DataDir, name, data); err != nil {
+				return nil, nil, fmt.Errorf("write %s: %w", name, err)
+			}
+		}
+	}
+
+	env, err := godotenv.Marshal(settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(filepath.Join(config.DataDir, bundleEnvFile), []byte(env+"\n"), 0o600); err != nil {
+		return nil, nil, err
+	}
+	for key := range settings {
+		written = append(written, key)
+	}
+	sort.Strings(written)
+	sort.Strings(skipped)
+	return written, skipped, nil
+}
+
+// runBundleCommand implements `gpt-bot export-bundle [file]` and `gpt-bot import-bundle <file>`.
+func runBundleCommand(args []string) error {
+	config := loadConfig()
+
+	switch args[0] {
+	case "export-bundle":
+		bundle, err := exportBundle(config)
+		if err != nil {
+			return err
+		}
+		out := io.Writer(os.Stdout)
+		if len(args) > 1 {
+			f, err := os.OpenFile(args[1], os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(bundle)
+
+	case "import-bundle":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: gpt-bot import-bundle <file>")
+		}
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		var bundle Bundle
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			return fmt.Errorf("parse bundle: %w", err)
+		}
+		written, skipped, err := importBundle(config, &bundle)
+		if err != nil {
+			return err
+		}
+		if len(skipped) > 0 {
+			fmt.Fprintf(os.Stderr, "Skipped %d settings that bundles may not carry, such as secrets and API endpoints: %v\n", len(skipped), skipped)
+		}
+		fmt.Printf("Imported %d settings into %s: %v\n", len(written), filepath.Join(config.DataDir, bundleEnvFile), written)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const usage = `Usage: gpt-bot [command]
+
+Commands:
+  run                   answer notifications (the default)
+  worker                answer the mentions queued at QUEUE_URL by "run"
+  login [flags]         authorize the bot's account and save the access token
+  verify                check the connections to the server and the GPT service
+  post [flags] <text>   post a status, split into a thread if it is too long
+  ask [flags] <text>    send text through the reply pipeline and print the reply
+  config check          check the configuration and the files it refers to
+  export-bundle [file]  write the configuration as a bundle
+  import-bundle <file>  install a configuration bundle
+
+Run "gpt-bot <command> -h" for the flags of login, post and ask.
+`
+
+// runCommand dispatches the command line to a subcommand.
+func runCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{"run"}
+	}
+
+	switch args[0] {
+	case "run":
+		newBot(loadConfig()).run()
+		return nil
+	case "worker":
+		newBot(loadConfig()).work()
+		return nil
+	case "login":
+		return loginCommand(args[1:])
+	case "verify":
+		// checkConnections exits if a connection fails.
+		newBot(loadConfig()).checkConnections(context.Background())
+		return nil
+	case "post":
+		return postCommand(args[1:])
+	case "ask":
+		return askCommand(args[1:])
+	case "config":
+		if len(args) < 2 || args[1] != "check" {
+			return errors.New("usage: gpt-bot config check")
+		}
+		return configCheckCommand()
+	case "export-bundle", "import-bundle":
+		return runBundleCommand(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// postCommand implements `gpt-bot post`, posting text as the bot.
+func postCommand(args []string) error {
+	fs := flag.NewFlagSet("post", flag.ExitOnError)
+	visibility := fs.String("visibility", "public", "public, unlisted, private or direct")
+	spoiler := fs.String("cw", "", "content warning")
+	language := fs.String("lang", "", "language code of the text")
+	inReplyTo := fs.String("reply-to", "", "ID of the status to reply to")
+	fs.Parse(args)
+	text := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if text == "" {
+		return errors.New("usage: gpt-bot post [flags] <text>")
+	}
+
+	b := newBot(loadConfig())
+	// Report a failure here rather than leaving the post for the next run.
+	b.outbox = nil
+	ctx := context.Background()
+	post := &StatusPost{
+		ContentType: "text/markdown",
+		Visibility:  *visibility,
+		Language:    *language,
+		SpoilerText: *spoiler,
+	}
+	last := b.postThread(ctx, post, "", *inReplyTo, b.splitReply(text, b.config.MaxChar))
+	if last == nil {
+		return errors.New("failed to post status")
+	}
+	fmt.Println(last.URL)
+	return nil
+}
+
+// askCommand implements `gpt-bot ask`, which answers text like a mention,
+// with moderation, personas and splitting, but prints the reply instead of
+// posting it.
+func askCommand(args []string) error {
+	fs := flag.NewFlagSet("ask", flag.ExitOnError)
+	model := fs.String("model", "", "model to use instead of the persona's or OPENAI_MODEL")
+	personaName := fs.String("persona", "", "persona to answer as")
+	fs.Parse(args)
+	text := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if text == "" {
+		return errors.New("usage: gpt-bot ask [flags] <text>")
+	}
+
+	b := newBot(loadConfig())
+	ctx := context.Background()
+	acct := b.fullAcct(b.config.BotAccountName)
+	persona := b.personas.find(*personaName)
+	if *personaName != "" && persona == nil {
+		return fmt.Errorf("unknown persona %q", *personaName)
+	}
+	if *model == "" {
+		*model = b.personaModel(persona)
+	}
+
+	prompt := text
+	if b.config.PromptHardening {
+		prompt = bracketUntrusted("local", text)
+	}
+	chatHistory := []Message{
+		{Role: "system", ChatContent: []ChatContent{{Type: "text", Text: b.systemPrompt(persona, b.promptVars(nil, persona))}}},
+		{Role: "user", ChatContent: []ChatContent{{Type: "text", Text: prompt}}},
+	}
+	b.screenInjections(ctx, chatHistory)
+	printChatHistory(chatHistory)
+
+	if b.moderateInput(ctx, acct, chatHistory) {
+		fmt.Println(b.moderationMessage(""))
+		return nil
+	}
+	completion := b.callGPT(ctx, chatHistory, *model, b.configuredParams(), "")
+	response := completion.Content
+	if response == "" {
+		return errors.New("empty response from GPT service")
+	}
+	if b.moderateOutput(ctx, acct, response) {
+		response = b.moderationMessage("")
+	}
+
+	parts := b.splitReply(decorateReply(persona, response), b.config.MaxChar)
+	for i, part := range parts {
+		if len(parts) > 1 {
+			fmt.Printf("--- %d/%d (%d characters)\n", i+1, len(parts), statusLength(part))
+		}
+		fmt.Println(part)
+	}
+	if completion.Usage != nil {
+		fmt.Printf("--- %s: %d prompt + %d completion tokens\n", completion.Model, completion.Usage.PromptTokens, completion.Usage.CompletionTokens)
+	}
+	return nil
+}
+
+// configCheckCommand implements `gpt-bot config check`.
+func configCheckCommand() error {
+	problems := checkConfig(loadConfig())
+	if len(problems) == 0 {
+		fmt.Println("Configuration OK")
+		return nil
+	}
+	for _, problem := range problems {
+		fmt.Println("- " + problem)
+	}
+	return fmt.Errorf("found %d configuration problems", len(problems))
+}
+
+// checkConfig returns the problems found in config: missing or invalid
+// settings, and files that cannot be read or refer to unknown personas or
+// providers.
+func checkConfig(config Config) []string {
+	var problems []string
+	report := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, required := range []struct{ key, value string }{
+		{"FEDI_DOMAIN", config.FediDomain},
+		{"ACCESS_TOKEN", config.AccessToken},
+		{"BOT_ACCOUNT_NAME", config.BotAccountName},
+		{"OPENAI_API_KEY", config.OpenAIAPIKey},
+	} {
+		if required.value == "" {
+			report("%s is not set", required.key)
+		}
+	}
+
+	choices := []struct {
+		key, value string
+		allowed    []string
+	}{
+		{"BACKEND", config.Backend, []string{"gotosocial", "mastodon", "misskey"}},
+		{"POLL_MODE", config.PollMode, []string{"clear", "delta"}},
+		{"OPENAI_PROVIDER", config.OpenAIProvider, []string{"openai", "azure"}},
+		{"FOLLOW_REQUEST_POLICY", config.FollowRequestPolicy, []string{"all", "local", "domains", "pending"}},
+		{"INLINE_OVERRIDES", config.InlineOverrides, []string{"all", "admins", "none"}},
+		{"SENSITIVE_MEDIA", config.SensitiveMedia, []string{"include", "described", "skip"}},
+		{"CW_POLICY", config.CWPolicy, []string{"inherit", "always", "model"}},
+		{"FAVOURITE_ACTION", config.FavouriteAction, reactionActions},
+	}
+	for _, c := range choices {
+		if !slices.Contains(c.allowed, c.value) {
+			report("%s is %q, expected one of %s", c.key, c.value, strings.Join(c.allowed, ", "))
+		}
+	}
+	if config.QueueURL != "" {
+		if _, err := newRedisClient(config.QueueURL); err != nil {
+			report("QUEUE_URL: %v", err)
+		}
+		if config.QueueLease <= config.NotificationTimeout {
+			report("QUEUE_LEASE (%v) should be longer than NOTIFICATION_TIMEOUT (%v), or jobs are requeued while workers are still on them", config.QueueLease, config.NotificationTimeout)
+		}
+	}
+	if config.ExportURL != "" && config.ExportDir == "" {
+		report("EXPORT_URL is set, but EXPORT_DIR is not")
+	}
+	if err := checkPrompt(config.SystemPrompt); err != nil {
+		report("SYSTEM_PROMPT: %v", err)
+	}
+	for emoji, action := range config.ReactionActions {
+		if !slices.Contains(reactionActions, action) {
+			report("REACTION_ACTIONS: %s=%s, expected one of %s", emoji, action, strings.Join(reactionActions, ", "))
+		}
+	}
+	for name, p := range config.Providers {
+		if p.Type != "openai" && p.Type != "azure" {
+			report("PROVIDER_%s_TYPE is %q, expected openai or azure", strings.ToUpper(name), p.Type)
+		}
+	}
+	if _, err := config.GTSTransport.transport(); err != nil {
+		report("GTS_PROXY, GTS_CA_FILE: %v", err)
+	}
+	if _, err := config.LLMTransport.transport(); err != nil {
+		report("LLM_PROXY, LLM_CA_FILE: %v", err)
+	}
+	if config.MaxChar <= 0 {
+		report("MAX_CHAR must be positive")
+	}
+
+	var personas []*Persona
+	var schedules []*Schedule
+	var feeds []*Feed
+	var subscriptions []*Subscription
+	for _, f := range []struct {
+		key, file string
+		v         any
+	}{
+		{"PERSONAS_FILE", config.PersonasFile, &personas},
+		{"SCHEDULES_FILE", config.SchedulesFile, &schedules},
+		{"FEEDS_FILE", config.FeedsFile, &feeds},
+		{"SUBSCRIPTIONS_FILE", config.SubscriptionsFile, &subscriptions},
+	} {
+		if f.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.file)
+		if err == nil {
+			err = json.Unmarshal(data, f.v)
+		}
+		if err != nil {
+			report("%s: %v", f.key, err)
+		}
+	}
+
+	known := map[string]bool{"": true}
+	for _, p := range personas {
+		known[p.Name] = true
+	}
+	modelNames := append([]string{config.OpenAIModel, config.OpenAIModelExternal, config.VisionModel}, config.FallbackModels...)
+	for _, p := range personas {
+		modelNames = append(modelNames, p.Model)
+		if err := checkPrompt(p.SystemPrompt); err != nil {
+			report("persona %q: %v", p.Name, err)
+		}
+	}
+	for _, s := range schedules {
+		if _, err := parseCron(s.Cron); err != nil {
+			report("schedule %q: %v", s.Name, err)
+		}
+		if !known[s.Persona] {
+			report("schedule %q: unknown persona %q", s.Name, s.Persona)
+		}
+		modelNames = append(modelNames, s.Model)
+	}
+	for _, f := range feeds {
+		if f.Cron != "" {
+			if _, err := parseCron(f.Cron); err != nil {
+				report("feed %q: %v", f.URL, err)
+			}
+		}
+		if !known[f.Persona] {
+			report("feed %q: unknown persona %q", f.URL, f.Persona)
+		}
+		modelNames = append(modelNames, f.Model)
+	}
+	for _, s := range subscriptions {
+		if !known[s.Persona] {
+			report("subscription %q: unknown persona %q", s.Account, s.Persona)
+		}
+		modelNames = append(modelNames, s.Model)
+	}
+	for _, model := range modelNames {
+		if _, provider := splitModel(model); provider != "" {
+			if _, ok := config.Providers[provider]; !ok {
+				report("model %q: provider %q is not configured", model, provider)
+			}
+		}
+	}
+	return problems
+}
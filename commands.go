@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const commandPrefix = "!"
+
+type commandHandler func(ctx context.Context, b *Bot, status *models.Status, args []string) string
+
+var commands = map[string]commandHandler{
+	"usage":     usageCommand,
+	"persona":   personaCommand,
+	"describe":  describeCommand,
+	"translate": translateCommand,
+	"summarize": summarizeCommand,
+	"forgetme":  forgetmeCommand,
+	"export":    exportCommand,
+}
+
+// generatedCommands are the commands whose replies are written by the model,
+// which are moderated like other replies.
+var generatedCommands = map[string]bool{
+	"translate": true,
+	"summarize": true,
+	"describe":  true,
+}
+
+func init() {
+	// Registered here to avoid an initialization cycle, since help lists the commands.
+	commands["help"] = helpCommand
+}
+
+// parseCommand extracts a "!command args..." invocation following any leading mentions.
+func (b *Bot) parseCommand(status *models.Status) (string, []string, bool) {
+	fields := strings.Fields(statusText(status))
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], commandPrefix) {
+		return "", nil, false
+	}
+
+	name, ok := b.catalog.resolveCommand(strings.TrimPrefix(fields[0], commandPrefix))
+	if !ok {
+		return "", nil, false
+	}
+	return name, fields[1:], true
+}
+
+// handleCommand runs a command and replies with its response. Handlers get a
+// copy of status, on which they may set the language of their response.
+func (b *Bot) handleCommand(ctx context.Context, status *models.Status, name string, args []string) {
+	in := *status
+	response := commands[name](ctx, b, &in, args)
+	if response == "" {
+		return
+	}
+	if generatedCommands[name] && b.moderateOutput(ctx, b.fullAcct(status.Account.Acct), response) {
+		b.replyToStatus(ctx, &in, b.moderationMessage(in.Language))
+		return
+	}
+	b.replyToStatus(ctx, &in, response)
+}
+
+// commandCompletion runs the model request of a command sent in status. It
+// returns the generated text, or false and the reply to send instead if the
+// input is flagged by moderation or the request fails.
+func (b *Bot) commandCompletion(ctx context.Context, status *models.Status, chatHistory []Message, model string) (string, bool) {
+	acct := b.fullAcct(status.Account.Acct)
+	if b.moderateInput(ctx, acct, chatHistory) {
+		return b.moderationMessage(status.Language), false
+	}
+	completion, err := b.completeWithFallback(ctx, chatHistory, model, GenerationParams{})
+	if err != nil {
+		log.Printf("Failed to complete command request: %v", err)
+		return b.catalog.message(status.Language, "error.gpt"), false
+	}
+	b.usage.record(acct, completion.Usage)
+	return completion.Content, true
+}
+
+// fullAcct qualifies local account names with the instance domain.
+func (b *Bot) fullAcct(acct string) string {
+	if strings.Contains(acct, "@") {
+		return acct
+	}
+	return fmt.Sprintf("%s@%s", acct, b.config.FediDomain)
+}
+
+func (b *Bot) isBotAccount(acct string) bool {
+	return b.fullAcct(acct) == b.fullAcct(b.config.BotAccountName)
+}
+
+func (b *Bot) isAdmin(acct string) bool {
+	for _, admin := range b.config.AdminAccounts {
+		if b.fullAcct(strings.TrimPrefix(admin, "@")) == b.fullAcct(acct) {
+			return true
+		}
+	}
+	return false
+}
+
+func helpCommand(ctx context.Context, b *Bot, status *models.Status, args []string) string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lang := status.Language
+	var sb strings.Builder
+	sb.WriteString(b.catalog.message(lang, "help.header"))
+	for _, name := range names {
+		sb.WriteString("\n" + commandPrefix + name)
+		if aliases := b.catalog.commandAliases(lang, name); len(aliases) > 0 {
+			list := commandPrefix + strings.Join(aliases, b.catalog.message(lang, "list.separator")+commandPrefix)
+			sb.WriteString(fmt.Sprintf(b.catalog.message(lang, "help.aliases"), list))
+		}
+	}
+	return sb.String()
+}
+
+func usageCommand(ctx context.Context, b *Bot, status *models.Status, args []string) string {
+	lang := status.Language
+	if len(args) > 0 && args[0] == "top" {
+		if !b.isAdmin(status.Account.Acct) {
+			return b.catalog.message(lang, "usage.admins_only")
+		}
+		top := b.usage.topToday(10)
+		if len(top) == 0 {
+			return b.catalog.message(lang, "usage.top_none")
+		}
+		var sb strings.Builder
+		sb.WriteString(b.catalog.message(lang, "usage.top_header"))
+		for i, u := range top {
+			fmt.Fprintf(&sb, "\n"+b.catalog.message(lang, "usage.top_entry"), i+1, u.Acct, u.Requests, u.TotalTokens)
+		}
+		return sb.String()
+	}
+
+	u := b.usage.today(b.fullAcct(status.Account.Acct))
+	return fmt.Sprintf(b.catalog.message(lang, "usage.today"),
+		u.Requests, u.TotalTokens, u.PromptTokens, u.CompletionTokens)
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
-	"context"
+	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-openapi/runtime"
@@ -12,43 +16,139 @@ import (
 	"github.com/go-openapi/strfmt"
 	"github.com/joho/godotenv"
 	gtsclient "github.com/owu-one/gotosocial-sdk/client"
-	"github.com/owu-one/gotosocial-sdk/models"
 	"golang.org/x/time/rate"
 )
 
-var (
-	gts               Client
-	openAI            *http.Client
-	config            Config
-	notificationStack []*models.Notification
-)
-
 type Client struct {
 	Client  *gtsclient.GoToSocialSwaggerDocumentation
 	Auth    runtime.ClientAuthInfoWriter
+	API     *apiClient // for endpoints the SDK does not cover
 	limiter *rate.Limiter
-	ctx     context.Context
 }
 
 type Config struct {
-	OpenAIAPIKey        string
-	OpenAIAPIURL        string
-	OpenAIModel         string
-	OpenAIModelExternal string
-	FediDomain          string
-	ClientKey           string
-	ClientSecret        string
-	AccessToken         string
-	BotAccountName      string
-	MaxChar             int
-	MaxHistoryCount     int
-	MaxHistoryChar      int
-	SystemPrompt        string
+	OpenAIAPIKey             string
+	OpenAIAPIURL             string
+	OpenAIProvider           string
+	AzureAPIVersion          string
+	Providers                map[string]LLMProvider
+	FallbackModels           []string
+	OpenAIModel              string
+	OpenAIModelExternal      string
+	VisionModel              string
+	ReasoningModels          []string
+	ReasoningMaxTokens       int
+	ReasoningEffort          string
+	Temperature              *float64
+	TopP                     *float64
+	MaxTokens                int
+	FrequencyPenalty         *float64
+	Stop                     []string
+	InlineOverrides          string
+	FediDomain               string
+	ClientKey                string
+	ClientSecret             string
+	AccessToken              string
+	BotAccountName           string
+	MaxChar                  int
+	MaxContinuationPosts     int
+	MaxHistoryCount          int
+	MaxHistoryTokens         int
+	ModelContextTokens       map[string]int
+	DefaultContextTokens     int
+	ResponseTokenReserve     int
+	ImageTokens              int
+	ImageMaxDimension        int
+	ImageQuality             int
+	MaxImagesPerRequest      int
+	ImageByteBudget          int
+	SensitiveMedia           string
+	SystemPrompt             string
+	AdminAccounts            []string
+	DataDir                  string
+	LangDir                  string
+	DefaultLanguage          string
+	MatchLanguage            bool
+	CWPolicy                 string
+	CWText                   string
+	CustomEmoji              bool
+	CustomEmojiPromptLimit   int
+	PersonasFile             string
+	ModerateInput            bool
+	ModerateOutput           bool
+	ModerationURL            string
+	ModerationModel          string
+	ModerationMessage        string
+	PromptHardening          bool
+	InjectionClassifierModel string
+	GTSTimeout               time.Duration
+	GTSRetries               int
+	LLMTimeout               time.Duration
+	LLMRetries               int
+	MediaTimeout             time.Duration
+	MediaRetries             int
+	RetryBackoff             time.Duration
+	OutboxMaxAttempts        int
+	OutboxRetryInterval      time.Duration
+	QueueURL                 string
+	QueueName                string
+	QueueWorkers             int
+	QueueLease               time.Duration
+	QueueMaxAttempts         int
+	NotificationTimeout      time.Duration
+	ShutdownTimeout          time.Duration
+	DashboardAddr            string
+	DashboardToken           string
+	DebugAddr                string
+	DebugToken               string
+	ExportDir                string
+	ExportURL                string
+	GTSTransport             TransportSettings
+	LLMTransport             TransportSettings
+	PollMode                 string
+	PollInterval             time.Duration
+	PollMaxInterval          time.Duration
+	PollLimit                int
+	ArchiveConversations     bool
+	MaxParticipants          int
+	MaxThreadReplies         int
+	ThreadLimitNotice        bool
+	SpamWindow               time.Duration
+	SpamRepeatLimit          int
+	SpamNewAccountAge        time.Duration
+	SpamNewAccountLimit      int
+	SpamCooldown             time.Duration
+	SpamBlockAfter           int
+	SpamDomains              []string
+	FavouriteAction          string
+	ReactionActions          map[string]string
+	StreamReplies            bool
+	StreamEditInterval       time.Duration
+	PollCreation             bool
+	LinkFetch                bool
+	WelcomeDM                bool
+	WelcomeMessage           string
+	FollowBack               bool
+	FollowRequestPolicy      string
+	FollowRequestDomains     []string
+	SchedulesFile            string
+	FeedsFile                string
+	SubscriptionsFile        string
+	Backend                  string
+	ScheduleTimezone         *time.Location
+	LinkTimeout              time.Duration
+	LinkMaxBytes             int
+	LinkMaxChars             int
+	DryRun                   bool
+	DryRunReply              string
 }
 
 type Message struct {
 	Role        string        `json:"role"`
 	ChatContent []ChatContent `json:"content"`
+	// authors are the accounts whose posts, or quoted posts, the message
+	// holds, for the archive. They are not sent.
+	authors []string
 }
 
 type ChatContent struct {
@@ -62,32 +162,144 @@ type ImageContent struct {
 	Detail string `json:"detail,omitempty"` // default: auto
 }
 
-func init() {
-	loadConfig()
-	initClients()
-}
-
-func loadConfig() {
+func loadConfig() Config {
 	godotenv.Load()
+	// Settings imported from a bundle apply unless set in the environment or .env.
+	godotenv.Load(filepath.Join(getEnv("DATA_DIR", "data"), bundleEnvFile))
 
-	config = Config{
-		OpenAIAPIKey:        getEnv("OPENAI_API_KEY", ""),
-		OpenAIAPIURL:        getEnv("OPENAI_API_URL", "https://api.openai.com/v1"),
-		OpenAIModel:         getEnv("OPENAI_MODEL", "gpt-4o-mini"),
-		OpenAIModelExternal: getEnv("OPENAI_MODEL_EXTERNAL", "gpt-4o-mini"),
-		FediDomain:          getEnv("FEDI_DOMAIN", ""),
-		ClientKey:           getEnv("CLIENT_KEY", ""),
-		ClientSecret:        getEnv("CLIENT_SECRET", ""),
-		AccessToken:         getEnv("ACCESS_TOKEN", ""),
-		BotAccountName:      getEnv("BOT_ACCOUNT_NAME", ""),
-		MaxChar:             getEnvAsInt("MAX_CHAR", 450),
-		MaxHistoryCount:     getEnvAsInt("MAX_HISTORY_COUNT", 6),
-		MaxHistoryChar:      getEnvAsInt("MAX_HISTORY_CHAR", 5000),
-		SystemPrompt:        getEnv("SYSTEM_PROMPT", ""),
+	return Config{
+		OpenAIAPIKey:             getEnv("OPENAI_API_KEY", ""),
+		OpenAIAPIURL:             strings.TrimSuffix(getEnv("OPENAI_API_URL", "https://api.openai.com/v1"), "/"),
+		OpenAIProvider:           getEnv("OPENAI_PROVIDER", "openai"),
+		AzureAPIVersion:          getEnv("AZURE_API_VERSION", "2024-10-21"),
+		Providers:                getEnvProviders(),
+		FallbackModels:           getEnvAsList("FALLBACK_MODELS", nil),
+		OpenAIModel:              getEnv("OPENAI_MODEL", "gpt-4o-mini"),
+		OpenAIModelExternal:      getEnv("OPENAI_MODEL_EXTERNAL", "gpt-4o-mini"),
+		VisionModel:              getEnv("VISION_MODEL", ""),
+		ReasoningModels:          getEnvAsList("REASONING_MODELS", []string{"o1", "o3", "o4-mini", "deepseek-reasoner"}),
+		ReasoningMaxTokens:       getEnvAsInt("REASONING_MAX_TOKENS", 0),
+		ReasoningEffort:          getEnv("REASONING_EFFORT", ""),
+		Temperature:              getEnvAsFloat("TEMPERATURE", nil),
+		TopP:                     getEnvAsFloat("TOP_P", nil),
+		MaxTokens:                getEnvAsInt("MAX_TOKENS", 0),
+		FrequencyPenalty:         getEnvAsFloat("FREQUENCY_PENALTY", nil),
+		Stop:                     getEnvAsList("STOP", nil),
+		InlineOverrides:          getEnv("INLINE_OVERRIDES", "admins"),
+		FediDomain:               getEnv("FEDI_DOMAIN", ""),
+		ClientKey:                getEnv("CLIENT_KEY", ""),
+		ClientSecret:             getEnv("CLIENT_SECRET", ""),
+		AccessToken:              getEnv("ACCESS_TOKEN", ""),
+		BotAccountName:           getEnv("BOT_ACCOUNT_NAME", ""),
+		MaxChar:                  getEnvAsInt("MAX_CHAR", 450),
+		MaxContinuationPosts:     getEnvAsInt("MAX_CONTINUATION_POSTS", 4),
+		MaxHistoryCount:          getEnvAsInt("MAX_HISTORY_COUNT", 6),
+		MaxHistoryTokens:         getEnvAsInt("MAX_HISTORY_TOKENS", 4000),
+		ModelContextTokens:       getEnvAsIntMap("MODEL_CONTEXT_TOKENS", map[string]int{"gpt-4o": 128000, "gpt-4o-mini": 128000}),
+		DefaultContextTokens:     getEnvAsInt("DEFAULT_CONTEXT_TOKENS", 16000),
+		ResponseTokenReserve:     getEnvAsInt("RESPONSE_TOKEN_RESERVE", 1000),
+		ImageTokens:              getEnvAsInt("IMAGE_TOKENS", 765),
+		ImageMaxDimension:        getEnvAsInt("IMAGE_MAX_DIMENSION", 1568),
+		ImageQuality:             getEnvAsInt("IMAGE_QUALITY", 85),
+		MaxImagesPerRequest:      getEnvAsInt("MAX_IMAGES_PER_REQUEST", 4),
+		ImageByteBudget:          getEnvAsInt("IMAGE_BYTE_BUDGET", 8<<20),
+		SensitiveMedia:           getEnv("SENSITIVE_MEDIA", "include"),
+		SystemPrompt:             getEnv("SYSTEM_PROMPT", ""),
+		AdminAccounts:            getEnvAsList("ADMIN_ACCOUNTS", nil),
+		DataDir:                  getEnv("DATA_DIR", "data"),
+		LangDir:                  getEnv("LANG_DIR", ""),
+		DefaultLanguage:          getEnv("DEFAULT_LANGUAGE", "en"),
+		MatchLanguage:            getEnvAsBool("MATCH_LANGUAGE", true),
+		CWPolicy:                 getEnv("CW_POLICY", "inherit"),
+		CWText:                   getEnv("CW_TEXT", ""),
+		CustomEmoji:              getEnvAsBool("CUSTOM_EMOJI", true),
+		CustomEmojiPromptLimit:   getEnvAsInt("CUSTOM_EMOJI_PROMPT_LIMIT", 0),
+		PersonasFile:             getEnv("PERSONAS_FILE", ""),
+		ModerateInput:            getEnvAsBool("MODERATE_INPUT", false),
+		ModerateOutput:           getEnvAsBool("MODERATE_OUTPUT", false),
+		ModerationURL:            getEnv("MODERATION_URL", ""),
+		ModerationModel:          getEnv("MODERATION_MODEL", "omni-moderation-latest"),
+		ModerationMessage:        getEnv("MODERATION_MESSAGE", ""),
+		PromptHardening:          getEnvAsBool("PROMPT_HARDENING", true),
+		InjectionClassifierModel: getEnv("INJECTION_CLASSIFIER_MODEL", ""),
+		GTSTimeout:               getEnvAsDuration("GTS_TIMEOUT", 30*time.Second),
+		GTSRetries:               getEnvAsInt("GTS_RETRIES", 2),
+		LLMTimeout:               getEnvAsDuration("LLM_TIMEOUT", 60*time.Second),
+		LLMRetries:               getEnvAsInt("LLM_RETRIES", 1),
+		MediaTimeout:             getEnvAsDuration("MEDIA_TIMEOUT", 30*time.Second),
+		MediaRetries:             getEnvAsInt("MEDIA_RETRIES", 2),
+		RetryBackoff:             getEnvAsDuration("RETRY_BACKOFF", time.Second),
+		OutboxMaxAttempts:        getEnvAsInt("OUTBOX_MAX_ATTEMPTS", 10),
+		OutboxRetryInterval:      getEnvAsDuration("OUTBOX_RETRY_INTERVAL", time.Minute),
+		QueueURL:                 getEnv("QUEUE_URL", ""),
+		QueueName:                getEnv("QUEUE_NAME", "gpt-bot"),
+		QueueWorkers:             getEnvAsInt("QUEUE_WORKERS", 1),
+		QueueLease:               getEnvAsDuration("QUEUE_LEASE", 10*time.Minute),
+		QueueMaxAttempts:         getEnvAsInt("QUEUE_MAX_ATTEMPTS", 3),
+		NotificationTimeout:      getEnvAsDuration("NOTIFICATION_TIMEOUT", 5*time.Minute),
+		ShutdownTimeout:          getEnvAsDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		DashboardAddr:            getEnv("DASHBOARD_ADDR", ""),
+		DashboardToken:           getEnv("DASHBOARD_TOKEN", ""),
+		DebugAddr:                getEnv("DEBUG_ADDR", ""),
+		DebugToken:               getEnv("DEBUG_TOKEN", ""),
+		ExportDir:                getEnv("EXPORT_DIR", ""),
+		ExportURL:                getEnv("EXPORT_URL", ""),
+		GTSTransport:             getEnvTransport("GTS_"),
+		LLMTransport:             getEnvTransport("LLM_"),
+		PollMode:                 getEnv("POLL_MODE", "clear"),
+		PollInterval:             getEnvAsDuration("POLL_INTERVAL", 20*time.Second),
+		PollMaxInterval:          getEnvAsDuration("POLL_MAX_INTERVAL", 2*time.Minute),
+		PollLimit:                getEnvAsInt("POLL_LIMIT", 10),
+		ArchiveConversations:     getEnvAsBool("ARCHIVE_CONVERSATIONS", false),
+		MaxParticipants:          getEnvAsInt("MAX_PARTICIPANTS", 0),
+		MaxThreadReplies:         getEnvAsInt("MAX_THREAD_REPLIES", 0),
+		ThreadLimitNotice:        getEnvAsBool("THREAD_LIMIT_NOTICE", true),
+		SpamWindow:               getEnvAsDuration("SPAM_WINDOW", 10*time.Minute),
+		SpamRepeatLimit:          getEnvAsInt("SPAM_REPEAT_LIMIT", 3),
+		SpamNewAccountAge:        getEnvAsDuration("SPAM_NEW_ACCOUNT_AGE", 72*time.Hour),
+		SpamNewAccountLimit:      getEnvAsInt("SPAM_NEW_ACCOUNT_LIMIT", 5),
+		SpamCooldown:             getEnvAsDuration("SPAM_COOLDOWN", time.Hour),
+		SpamBlockAfter:           getEnvAsInt("SPAM_BLOCK_AFTER", 3),
+		SpamDomains:              getEnvAsList("SPAM_DOMAINS", nil),
+		FavouriteAction:          getEnv("FAVOURITE_ACTION", actionNone),
+		ReactionActions:          getEnvAsMap("REACTION_ACTIONS", nil),
+		StreamReplies:            getEnvAsBool("STREAM_REPLIES", false),
+		StreamEditInterval:       getEnvAsDuration("STREAM_EDIT_INTERVAL", 3*time.Second),
+		PollCreation:             getEnvAsBool("POLL_CREATION", false),
+		LinkFetch:                getEnvAsBool("LINK_FETCH", false),
+		WelcomeDM:                getEnvAsBool("WELCOME_DM", false),
+		WelcomeMessage:           getEnv("WELCOME_MESSAGE", ""),
+		FollowBack:               getEnvAsBool("FOLLOW_BACK", false),
+		FollowRequestPolicy:      getEnv("FOLLOW_REQUEST_POLICY", "pending"),
+		FollowRequestDomains:     getEnvAsList("FOLLOW_REQUEST_DOMAINS", nil),
+		SchedulesFile:            getEnv("SCHEDULES_FILE", ""),
+		FeedsFile:                getEnv("FEEDS_FILE", ""),
+		SubscriptionsFile:        getEnv("SUBSCRIPTIONS_FILE", ""),
+		Backend:                  getEnv("BACKEND", "gotosocial"),
+		ScheduleTimezone:         getEnvAsLocation("SCHEDULE_TIMEZONE", time.Local),
+		LinkTimeout:              getEnvAsDuration("LINK_TIMEOUT", 10*time.Second),
+		LinkMaxBytes:             getEnvAsInt("LINK_MAX_BYTES", 2<<20),
+		LinkMaxChars:             getEnvAsInt("LINK_MAX_CHARS", 8000),
+		DryRun:                   getEnvAsBool("DRY_RUN", false),
+		DryRunReply:              getEnv("DRY_RUN_REPLY", ""),
 	}
 }
 
+// knownKeys records every setting read through getEnv, so bundles can list them.
+var knownKeys sync.Map
+
+func configKeys() []string {
+	var keys []string
+	knownKeys.Range(func(k, _ any) bool {
+		keys = append(keys, k.(string))
+		return true
+	})
+	sort.Strings(keys)
+	return keys
+}
+
 func getEnv(key, defaultValue string) string {
+	knownKeys.Store(key, true)
 	value := os.Getenv(key)
 	if value == "" {
 		return defaultValue
@@ -103,17 +315,128 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
-func initClients() {
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsFloat returns a pointer, so that unset values (nil) can be left out of requests.
+func getEnvAsFloat(key string, defaultValue *float64) *float64 {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return &value
+	}
+	return defaultValue
+}
+
+// getEnvAsDuration accepts Go durations ("1m30s") or a plain number of seconds.
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := getEnv(key, "")
+	if value, err := time.ParseDuration(valueStr); err == nil {
+		return value
+	}
+	if value, err := strconv.Atoi(valueStr); err == nil {
+		return time.Duration(value) * time.Second
+	}
+	return defaultValue
+}
+
+func getEnvAsLocation(key string, defaultValue *time.Location) *time.Location {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	loc, err := time.LoadLocation(valueStr)
+	if err != nil {
+		log.Printf("Invalid time zone %s=%s: %v", key, valueStr, err)
+		return defaultValue
+	}
+	return loc
+}
+
+func getEnvAsList(key string, defaultValue []string) []string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	var values []string
+	for _, v := range strings.Split(valueStr, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// getEnvAsIntMap parses comma-separated key=value pairs, e.g. "gpt-4o=128000,gpt-4o-mini=128000".
+func getEnvAsIntMap(key string, defaultValue map[string]int) map[string]int {
+	values := map[string]int{}
+	for _, pair := range getEnvAsList(key, nil) {
+		k, v, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if !ok || err != nil {
+			log.Printf("Ignoring invalid %s entry %q", key, pair)
+			continue
+		}
+		values[strings.TrimSpace(k)] = n
+	}
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values
+}
+
+// getEnvAsMap parses comma-separated key=value pairs, e.g. "🔁=regenerate,*=reciprocate".
+func getEnvAsMap(key string, defaultValue map[string]string) map[string]string {
+	values := map[string]string{}
+	for _, pair := range getEnvAsList(key, nil) {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			log.Printf("Ignoring invalid %s entry %q", key, pair)
+			continue
+		}
+		values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values
+}
+
+func newClients(config Config) (gts Client, openAI *http.Client, media *http.Client) {
+	gtsPolicy := RetryPolicy{Name: "GoToSocial", Timeout: config.GTSTimeout, Retries: config.GTSRetries, Backoff: config.RetryBackoff}
+	llmPolicy := RetryPolicy{Name: "GPT", Timeout: config.LLMTimeout, Retries: config.LLMRetries, Backoff: config.RetryBackoff, RetryPost: true}
+	mediaPolicy := RetryPolicy{Name: "Media", Timeout: config.MediaTimeout, Retries: config.MediaRetries, Backoff: config.RetryBackoff}
+
+	// Timeouts are applied per attempt by the retry transport instead of per
+	// operation, so that retries are not cut short by the operation deadline.
+	httptransport.DefaultTimeout = 0
+
+	gtsTransport, err := config.GTSTransport.transport()
+	if err != nil {
+		log.Fatalf("GoToSocial transport: %v", err)
+	}
+	llmTransport, err := config.LLMTransport.transport()
+	if err != nil {
+		log.Fatalf("GPT transport: %v", err)
+	}
+
+	gtsHTTP := newHTTPClient(gtsPolicy.validate(30*time.Second), gtsTransport)
 	gts = Client{
 		Client: gtsclient.New(
-			httptransport.New(config.FediDomain, "", []string{"https"}), strfmt.Default,
+			httptransport.NewWithClient(config.FediDomain, "", []string{"https"}, gtsHTTP),
+			strfmt.Default,
 		),
 		Auth:    httptransport.BearerToken(config.AccessToken),
+		API:     &apiClient{domain: config.FediDomain, token: config.AccessToken, http: gtsHTTP},
 		limiter: rate.NewLimiter(1.0, 300),
-		ctx:     context.Background(),
 	}
 
-	openAI = &http.Client{
-		Timeout: time.Second * 30,
-	}
+	openAI = newHTTPClient(llmPolicy.validate(60*time.Second), llmTransport)
+	media = newHTTPClient(mediaPolicy.validate(30*time.Second), http.DefaultTransport)
+
+	return gts, openAI, media
 }
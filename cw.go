@@ -0,0 +1,37 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// cwPrompt asks the model to propose a content warning with CW_POLICY=model.
+const cwPrompt = "\n\nIf your reply discusses a sensitive topic, such as violence, self-harm, health, politics or sexual content, make its first line \"CW: \" followed by a short content warning, and start the reply itself on the next line."
+
+var cwLineRe = regexp.MustCompile(`(?i)^\s*(?:CW|content warning)\s*[:：]\s*([^\n]+?)\s*(?:\n|$)`)
+
+// splitContentWarning separates a content warning the model proposed on the
+// first line of response from the reply itself.
+func splitContentWarning(response string) (cw, text string) {
+	m := cwLineRe.FindStringSubmatchIndex(response)
+	if m == nil {
+		return "", response
+	}
+	text = strings.TrimSpace(response[m[1]:])
+	if text == "" {
+		return "", response
+	}
+	return response[m[2]:m[3]], text
+}
+
+// autoContentWarning returns spoiler, or with CW_POLICY=always the label for
+// generated posts if spoiler is empty.
+func (b *Bot) autoContentWarning(spoiler, lang string) string {
+	if spoiler != "" || b.config.CWPolicy != "always" {
+		return spoiler
+	}
+	if b.config.CWText != "" {
+		return b.config.CWText
+	}
+	return b.catalog.message(lang, "cw.auto")
+}
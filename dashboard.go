@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recentLimit is how many handled mentions the dashboard shows.
+const recentLimit = 50
+
+// recentReply is a handled mention and the reply generated for it.
+type recentReply struct {
+	Time      time.Time
+	Acct      string
+	StatusURL string
+	Request   string
+	Reply     string
+	Model     string
+	Tokens    int
+}
+
+// recentReplies keeps the latest handled mentions in memory for the dashboard.
+type recentReplies struct {
+	mu      sync.Mutex
+	entries []recentReply
+}
+
+func (r *recentReplies) add(entry recentReply) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, entry)
+	if len(r.entries) > recentLimit {
+		r.entries = r.entries[len(r.entries)-recentLimit:]
+	}
+}
+
+// forget drops the entries of acct.
+func (r *recentReplies) forget(acct string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = slices.DeleteFunc(r.entries, func(e recentReply) bool { return e.Acct == acct })
+}
+
+// list returns the entries, newest first.
+func (r *recentReplies) list() []recentReply {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]recentReply, len(r.entries))
+	for i, entry := range r.entries {
+		list[len(list)-1-i] = entry
+	}
+	return list
+}
+
+// serveDashboard runs the web dashboard on DASHBOARD_ADDR until ctx is done.
+func (b *Bot) serveDashboard(ctx context.Context) {
+	if b.config.DashboardAddr == "" {
+		return
+	}
+	if b.config.DashboardToken == "" {
+		log.Println("DASHBOARD_TOKEN is not set, not starting the dashboard")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", b.dashboardPage)
+	mux.HandleFunc("POST /block", b.dashboardAction(func(form url.Values) {
+		if acct := strings.TrimPrefix(strings.TrimSpace(form.Get("acct")), "@"); acct != "" {
+			log.Printf("Dashboard: blocking %s", acct)
+			b.blocked.block(b.fullAcct(acct))
+		}
+	}))
+	mux.HandleFunc("POST /unblock", b.dashboardAction(func(form url.Values) {
+		log.Printf("Dashboard: unblocking %s", form.Get("acct"))
+		b.blocked.unblock(form.Get("acct"))
+	}))
+	mux.HandleFunc("POST /outbox/retry", b.dashboardAction(func(form url.Values) {
+		b.outbox.retryNow(form.Get("id"))
+	}))
+	mux.HandleFunc("POST /outbox/discard", b.dashboardAction(func(form url.Values) {
+		if b.outbox.discard(form.Get("id")) {
+			log.Printf("Dashboard: discarded outbox entry %s", form.Get("id"))
+		}
+	}))
+
+	server := &http.Server{
+		Addr:              b.config.DashboardAddr,
+		Handler:           tokenAuth(b.config.DashboardToken, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	log.Printf("Dashboard listening on %s", b.config.DashboardAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Dashboard stopped: %v", err)
+	}
+}
+
+// tokenAuth admits requests that carry token, as a bearer token or as the
+// password of HTTP basic authentication.
+func tokenAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			_, given, _ = r.BasicAuth()
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gpt-bot"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// dashboardAction handles a form posted from the dashboard and returns to it.
+// Forms from other sites are refused, since the browser sends the
+// credentials along with them.
+func (b *Bot) dashboardAction(action func(form url.Values)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		action(r.PostForm)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+func (b *Bot) dashboardPage(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Bot     string
+		DryRun  bool
+		Recent  []recentReply
+		Usage   []AccountUsage
+		Outbox  []outboxEntry
+		Blocked []string
+	}{
+		Bot:     b.fullAcct(b.config.BotAccountName),
+		DryRun:  b.config.DryRun,
+		Recent:  b.recent.list(),
+		Usage:   b.usage.topToday(recentLimit),
+		Outbox:  b.outbox.list(),
+		Blocked: b.blocked.list(),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Printf("Failed to render dashboard: %v", err)
+	}
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "next poll"
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Bot}} – gpt-bot</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+td.text { white-space: pre-wrap; max-width: 40em; }
+form { display: inline; }
+</style>
+</head>
+<body>
+<h1>{{.Bot}}{{if .DryRun}} (dry run){{end}}</h1>
+
+<h2>Recent Replies</h2>
+{{if .Recent}}<table>
+<tr><th>Time</th><th>Account</th><th>Request</th><th>Reply</th><th>Model</th><th>Tokens</th></tr>
+{{range .Recent}}<tr>
+<td><a href="{{.StatusURL}}">{{time .Time}}</a></td>
+<td>{{.Acct}} <form method="post" action="/block"><input type="hidden" name="acct" value="{{.Acct}}"><button>Block</button></form></td>
+<td class="text">{{.Request}}</td>
+<td class="text">{{.Reply}}</td>
+<td>{{.Model}}</td>
+<td>{{.Tokens}}</td>
+</tr>{{end}}
+</table>{{else}}<p>No replies since the bot started.</p>{{end}}
+
+<h2>Usage Today</h2>
+{{if .Usage}}<table>
+<tr><th>Account</th><th>Requests</th><th>Prompt tokens</th><th>Completion tokens</th><th>Total tokens</th></tr>
+{{range .Usage}}<tr><td>{{.Acct}}</td><td>{{.Requests}}</td><td>{{.PromptTokens}}</td><td>{{.CompletionTokens}}</td><td>{{.TotalTokens}}</td></tr>{{end}}
+</table>{{else}}<p>No usage today.</p>{{end}}
+
+<h2>Outbox</h2>
+{{if .Outbox}}<table>
+<tr><th>Next part</th><th>Parts</th><th>Attempts</th><th>Next attempt</th><th></th></tr>
+{{range .Outbox}}<tr>
+<td class="text">{{index .Parts 0}}</td>
+<td>{{len .Parts}}</td>
+<td>{{.Attempts}}</td>
+<td>{{time .NextAttempt}}</td>
+<td>
+<form method="post" action="/outbox/retry"><input type="hidden" name="id" value="{{.ID}}"><button>Retry now</button></form>
+<form method="post" action="/outbox/discard"><input type="hidden" name="id" value="{{.ID}}"><button>Discard</button></form>
+</td>
+</tr>{{end}}
+</table>{{else}}<p>Nothing queued.</p>{{end}}
+
+<h2>Blocked Accounts</h2>
+{{if .Blocked}}<table>
+{{range .Blocked}}<tr><td>{{.}}</td><td><form method="post" action="/unblock"><input type="hidden" name="acct" value="{{.}}"><button>Unblock</button></form></td></tr>{{end}}
+</table>{{end}}
+<form method="post" action="/block"><input name="acct" placeholder="user@example.com"> <button>Block</button></form>
+</body>
+</html>
+`))
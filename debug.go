@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const redacted = "[redacted]"
+
+// pollInfo describes the latest poll for notifications.
+type pollInfo struct {
+	Time          time.Time `json:"time"`
+	Notifications int       `json:"notifications"`
+	Error         string    `json:"error,omitempty"`
+}
+
+type lastPoll struct {
+	mu   sync.Mutex
+	info pollInfo
+}
+
+func (p *lastPoll) set(notifications int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.info = pollInfo{Time: time.Now(), Notifications: notifications}
+	if err != nil {
+		p.info.Error = err.Error()
+	}
+}
+
+func (p *lastPoll) get() pollInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.info
+}
+
+// serveDebug runs the pprof and /debug/state endpoints on DEBUG_ADDR until
+// ctx is done. Without DEBUG_TOKEN they are only served on a loopback address.
+func (b *Bot) serveDebug(ctx context.Context) {
+	if b.config.DebugAddr == "" {
+		return
+	}
+	if b.config.DebugToken == "" && !isLoopback(b.config.DebugAddr) {
+		log.Printf("DEBUG_ADDR %s is not a loopback address and DEBUG_TOKEN is not set, not starting the debug endpoint", b.config.DebugAddr)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/state", b.debugState)
+
+	var handler http.Handler = mux
+	if b.config.DebugToken != "" {
+		handler = tokenAuth(b.config.DebugToken, mux)
+	}
+	// No write timeout: CPU profiles and traces take as long as they are asked to.
+	server := &http.Server{Addr: b.config.DebugAddr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	log.Printf("Debug endpoint listening on %s", b.config.DebugAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Debug endpoint stopped: %v", err)
+	}
+}
+
+// isLoopback reports whether addr (host:port) only listens on a loopback interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// debugState writes the configuration, with secrets redacted, and the
+// runtime state of the bot as JSON.
+func (b *Bot) debugState(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	limiter := b.limiter
+
+	state := map[string]any{
+		"started":    b.started,
+		"uptime":     time.Since(b.started).Round(time.Second).String(),
+		"goroutines": runtime.NumGoroutine(),
+		"memory": map[string]any{
+			"heap_alloc":   mem.HeapAlloc,
+			"heap_objects": mem.HeapObjects,
+			"sys":          mem.Sys,
+			"num_gc":       mem.NumGC,
+		},
+		"config":    redactConfig(b.config),
+		"last_poll": b.lastPoll.get(),
+		"limiter": map[string]any{
+			"limit":  float64(limiter.Limit()),
+			"burst":  limiter.Burst(),
+			"tokens": limiter.Tokens(),
+		},
+		"poll_cursor":    b.cursor.get(),
+		"outbox":         len(b.outbox.list()),
+		"blocked":        len(b.blocked.list()),
+		"recent_replies": len(b.recent.list()),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(state); err != nil {
+		log.Printf("Failed to write debug state: %v", err)
+	}
+}
+
+// redactConfig returns config with its credentials replaced by a placeholder.
+func redactConfig(config Config) Config {
+	for _, secret := range []*string{
+		&config.OpenAIAPIKey, &config.ClientKey, &config.ClientSecret, &config.AccessToken,
+		&config.DashboardToken, &config.DebugToken,
+	} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	providers := make(map[string]LLMProvider, len(config.Providers))
+	for name, p := range config.Providers {
+		if p.Key != "" {
+			p.Key = redacted
+		}
+		providers[name] = p
+	}
+	config.Providers = providers
+	config.GTSTransport.Proxy = redactURL(config.GTSTransport.Proxy)
+	config.LLMTransport.Proxy = redactURL(config.LLMTransport.Proxy)
+	config.QueueURL = redactURL(config.QueueURL)
+	return config
+}
+
+// redactURL hides the password in a URL, such as a proxy's.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
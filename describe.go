@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const describePrompt = `Write alt text for the image, for people who cannot see it. In one or two concise sentences, describe what matters in it, and transcribe any important text. Reply with the alt text only, in the language with the code %q.`
+
+// describeCommand writes alt text for the images of the post it replies to,
+// or of its own post if the parent has none.
+func describeCommand(ctx context.Context, b *Bot, status *models.Status, args []string) string {
+	target := status
+	if status.InReplyToID != "" {
+		parent, err := b.backend.GetStatus(ctx, status.InReplyToID)
+		if err != nil {
+			log.Printf("Failed to get status to describe: %v", err)
+		} else if hasImageAttachments(parent) {
+			target = parent
+		}
+	}
+
+	lang := status.Language
+	if lang == "" {
+		lang = fallbackLanguage
+	}
+	model := b.config.VisionModel
+	if model == "" {
+		model = b.config.OpenAIModel
+	}
+
+	var descriptions []string
+	for _, attachment := range target.MediaAttachments {
+		if !isValidImageAttachment(attachment) {
+			continue
+		}
+		imageURL := b.imageDataURL(ctx, attachment)
+		if imageURL == "" {
+			continue
+		}
+		if b.config.ImageByteBudget > 0 && len(imageURL) > b.config.ImageByteBudget {
+			log.Printf("Skipping attachment %s: larger than the image budget", attachment.ID)
+			continue
+		}
+		description, ok := b.commandCompletion(ctx, status, []Message{
+			{Role: "system", ChatContent: []ChatContent{{Type: "text", Text: fmt.Sprintf(describePrompt, lang)}}},
+			{Role: "user", ChatContent: []ChatContent{{Type: "image_url", ImageURL: &ImageContent{URL: imageURL}}}},
+		}, model)
+		if !ok {
+			return description
+		}
+		descriptions = append(descriptions, description)
+	}
+
+	switch len(descriptions) {
+	case 0:
+		return b.catalog.message(status.Language, "describe.none")
+	case 1:
+		return descriptions[0]
+	}
+	var sb strings.Builder
+	for i, d := range descriptions {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, d)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func hasImageAttachments(status *models.Status) bool {
+	for _, attachment := range status.MediaAttachments {
+		if isValidImageAttachment(attachment) {
+			return true
+		}
+	}
+	return false
+}
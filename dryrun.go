@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// dryRunBackend reads from the server as usual but only logs what it would post.
+type dryRunBackend struct {
+	Backend
+	account *models.Account
+	seq     atomic.Int64
+}
+
+func (d *dryRunBackend) VerifyCredentials(ctx context.Context) (*models.Account, error) {
+	account, err := d.Backend.VerifyCredentials(ctx)
+	if err == nil {
+		d.account = account
+	}
+	return account, err
+}
+
+func (d *dryRunBackend) PostStatus(ctx context.Context, post *StatusPost) (*models.Status, error) {
+	id := fmt.Sprintf("dry-run-%d", d.seq.Add(1))
+	log.Printf("Dry run: would post %s (visibility %s, in reply to %q, CW %q, %d characters):\n%s",
+		id, post.Visibility, post.InReplyToID, post.SpoilerText, statusLength(post.Text), post.Text)
+	return &models.Status{
+		ID:          id,
+		Account:     d.account,
+		Content:     post.Text,
+		InReplyToID: post.InReplyToID,
+		Visibility:  post.Visibility,
+		Language:    post.Language,
+		SpoilerText: post.SpoilerText,
+		Sensitive:   post.Sensitive,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (d *dryRunBackend) DismissNotifications(ctx context.Context, ids []string) error {
+	log.Printf("Dry run: would dismiss %d notifications", len(ids))
+	return nil
+}
+
+func (d *dryRunBackend) React(ctx context.Context, statusID, emoji string) error {
+	log.Printf("Dry run: would react to %s with %q", statusID, emoji)
+	return nil
+}
+
+func (d *dryRunBackend) UploadMedia(ctx context.Context, data []byte, filename, description string) (*models.Attachment, error) {
+	id := fmt.Sprintf("dry-run-media-%d", d.seq.Add(1))
+	log.Printf("Dry run: would upload %s (%d bytes) as %s", filename, len(data), id)
+	return &models.Attachment{ID: id, Description: description}, nil
+}
+
+func (d *dryRunBackend) EditStatus(ctx context.Context, status *models.Status, text string) error {
+	log.Printf("Dry run: would edit %s to %d characters:\n%s", status.ID, statusLength(text), text)
+	return nil
+}
+
+func (d *dryRunBackend) DeleteStatus(ctx context.Context, id string) error {
+	log.Printf("Dry run: would delete %s", id)
+	return nil
+}
+
+func (d *dryRunBackend) Follow(ctx context.Context, accountID string, notify bool) error {
+	log.Printf("Dry run: would follow %s (notify %t)", accountID, notify)
+	return nil
+}
+
+func (d *dryRunBackend) AuthorizeFollowRequest(ctx context.Context, accountID string) error {
+	log.Printf("Dry run: would accept the follow request of %s", accountID)
+	return nil
+}
+
+// wouldDo logs an action skipped in dry-run mode and reports whether it was skipped.
+func (b *Bot) wouldDo(format string, args ...any) bool {
+	if !b.config.DryRun {
+		return false
+	}
+	log.Printf("Dry run: would "+format, args...)
+	return true
+}
+
+// stubCompletion returns DRY_RUN_REPLY in place of a model response, if it is set in dry-run mode.
+func (b *Bot) stubCompletion(model string) (*Completion, bool) {
+	if !b.config.DryRun || b.config.DryRunReply == "" {
+		return nil, false
+	}
+	completion := &Completion{Content: b.config.DryRunReply}
+	completion.Model = model
+	completion.FinishReason = "stop"
+	return completion, true
+}
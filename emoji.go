@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// emojiRefresh is how long the server's custom emoji are kept before they are fetched again.
+const emojiRefresh = time.Hour
+
+const emojiPrompt = "\n\nYou can use these custom emoji of the server by writing their shortcodes, colons included: %s. Do not make up other shortcodes."
+
+// shortcodeRe matches custom emoji shortcodes such as :blobcat:.
+var shortcodeRe = regexp.MustCompile(`:([a-zA-Z0-9_]{2,}):`)
+
+// emojiCache keeps the custom emoji of the server, by shortcode.
+type emojiCache struct {
+	mu      sync.Mutex
+	fetched time.Time
+	emojis  map[string]*models.Emoji
+	picker  []string
+}
+
+// instanceEmojis returns the server's custom emoji by shortcode, and the
+// shortcodes offered in its picker, fetching them at most every emojiRefresh.
+// The map is nil if they could never be fetched.
+func (b *Bot) instanceEmojis(ctx context.Context) (map[string]*models.Emoji, []string) {
+	c := b.emojis
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.fetched) < emojiRefresh {
+		return c.emojis, c.picker
+	}
+	// Failures are not retried before the next refresh either.
+	c.fetched = time.Now()
+	list, err := b.backend.CustomEmojis(ctx)
+	if err != nil {
+		log.Printf("Failed to get custom emoji: %v", err)
+		return c.emojis, c.picker
+	}
+	c.emojis = make(map[string]*models.Emoji, len(list))
+	c.picker = nil
+	for _, emoji := range list {
+		c.emojis[emoji.Shortcode] = emoji
+		if emoji.VisibleInPicker {
+			c.picker = append(c.picker, emoji.Shortcode)
+		}
+	}
+	return c.emojis, c.picker
+}
+
+// describeEmoji replaces the custom emoji in the text of status, which the
+// model cannot see, with their names, as in "[custom emoji: blobcat heart]".
+func (b *Bot) describeEmoji(ctx context.Context, status *models.Status, text string) string {
+	if !b.config.CustomEmoji || !strings.Contains(text, ":") {
+		return text
+	}
+	known, _ := b.instanceEmojis(ctx)
+	return replaceShortcodes(text, func(code string, bounded bool) (string, bool) {
+		if _, ok := known[code]; !bounded || !ok && !hasEmoji(status.Emojis, code) {
+			return "", false
+		}
+		return "[custom emoji: " + strings.ReplaceAll(code, "_", " ") + "]", true
+	})
+}
+
+func hasEmoji(emojis []*models.Emoji, code string) bool {
+	for _, emoji := range emojis {
+		if emoji != nil && emoji.Shortcode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// emojiInstructions lists up to CUSTOM_EMOJI_PROMPT_LIMIT of the server's
+// custom emoji for the model to use, or returns "" if none are offered.
+func (b *Bot) emojiInstructions(ctx context.Context) string {
+	if !b.config.CustomEmoji || b.config.CustomEmojiPromptLimit <= 0 {
+		return ""
+	}
+	_, picker := b.instanceEmojis(ctx)
+	if len(picker) == 0 {
+		return ""
+	}
+	if len(picker) > b.config.CustomEmojiPromptLimit {
+		picker = picker[:b.config.CustomEmojiPromptLimit]
+	}
+	codes := make([]string, len(picker))
+	for i, code := range picker {
+		codes[i] = ":" + code + ":"
+	}
+	return fmt.Sprintf(emojiPrompt, strings.Join(codes, ", "))
+}
+
+// fixEmoji checks the shortcodes in generated text against the server's
+// custom emoji. Unknown ones are removed, since they would show as text, and
+// known ones are set apart from adjacent words so that servers render them.
+// Code is left alone, as is everything if the emoji are unavailable.
+func (b *Bot) fixEmoji(ctx context.Context, text string) string {
+	if !b.config.CustomEmoji || !strings.Contains(text, ":") {
+		return text
+	}
+	known, _ := b.instanceEmojis(ctx)
+	if known == nil {
+		return text
+	}
+	folded := make(map[string]string, len(known))
+	for code := range known {
+		folded[strings.ToLower(code)] = code
+	}
+	return replaceShortcodes(text, func(code string, bounded bool) (string, bool) {
+		if _, ok := known[code]; ok {
+			return ":" + code + ":", true
+		}
+		if match, ok := folded[strings.ToLower(code)]; ok {
+			return ":" + match + ":", true
+		}
+		if bounded {
+			log.Printf("Removing unknown emoji :%s: from reply", code)
+		}
+		return "", bounded
+	})
+}
+
+// replaceShortcodes calls replace for each shortcode outside of Markdown code
+// in text, with whether it stands apart from adjacent words and shortcodes,
+// as servers require. If replace accepts it, the shortcode is replaced: by a
+// word set apart by spaces, or removed with the space before it if the
+// replacement is empty.
+func replaceShortcodes(text string, replace func(code string, bounded bool) (string, bool)) string {
+	// Odd segments between backticks are code, whether inline or fenced.
+	segments := strings.Split(text, "`")
+	for i := 0; i < len(segments); i += 2 {
+		segments[i] = replaceSegmentShortcodes(segments[i], replace)
+	}
+	return strings.Join(segments, "`")
+}
+
+func replaceSegmentShortcodes(text string, replace func(code string, bounded bool) (string, bool)) string {
+	matches := shortcodeRe.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+	var out strings.Builder
+	last := 0
+	for _, m := range matches {
+		before, _ := utf8.DecodeLastRuneInString(text[:m[0]])
+		after, _ := utf8.DecodeRuneInString(text[m[1]:])
+		joinedBefore := m[0] > 0 && isWordRune(before)
+		joinedAfter := m[1] < len(text) && isWordRune(after)
+		bounded := !joinedBefore && !joinedAfter && before != ':' && after != ':'
+		repl, ok := replace(text[m[2]:m[3]], bounded)
+		if !ok {
+			continue
+		}
+		prefix := text[last:m[0]]
+		if repl == "" {
+			if strings.HasSuffix(prefix, " ") && (m[1] == len(text) || after == ' ' || after == '\n' || unicode.IsPunct(after)) {
+				prefix = prefix[:len(prefix)-1]
+			}
+		} else {
+			if joinedBefore {
+				repl = " " + repl
+			}
+			if joinedAfter {
+				repl += " "
+			}
+		}
+		out.WriteString(prefix)
+		out.WriteString(repl)
+		last = m[1]
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// exportedStatus is a post of an exported thread.
+type exportedStatus struct {
+	ID          string `json:"id"`
+	URL         string `json:"url,omitempty"`
+	Acct        string `json:"acct"`
+	CreatedAt   string `json:"created_at"`
+	Visibility  string `json:"visibility"`
+	Text        string `json:"text"`
+	Attachments int    `json:"attachments,omitempty"`
+	Tokens      int    `json:"tokens"`
+	// InContext is false for posts trimmed from the model's context.
+	InContext bool `json:"in_context"`
+	// Withheld is true for posts the requester may not be able to see,
+	// whose text is left out.
+	Withheld bool `json:"withheld,omitempty"`
+}
+
+// threadExport is a thread as the bot would pass it to the model.
+type threadExport struct {
+	Exported      time.Time        `json:"exported"`
+	Requester     string           `json:"requester"`
+	Model         string           `json:"model"`
+	Persona       string           `json:"persona,omitempty"`
+	ContextBudget int              `json:"context_budget"`
+	Statuses      []exportedStatus `json:"statuses"`
+}
+
+// exportCommand sends the sender a transcript of the thread it replies to,
+// marking the posts that would be trimmed from the model's context, as text
+// or with "json" as JSON. The transcript is linked from EXPORT_URL if set,
+// attached otherwise, and posted as text if the server refuses the file. It
+// goes out as a direct message.
+func exportCommand(ctx context.Context, b *Bot, status *models.Status, args []string) string {
+	lang := status.Language
+	if status.InReplyToID == "" {
+		return b.catalog.message(lang, "export.none")
+	}
+	parent, err := b.backend.GetStatus(ctx, status.InReplyToID)
+	if err != nil {
+		log.Printf("Failed to get status to export: %v", err)
+		return b.catalog.message(lang, "export.none")
+	}
+
+	acct := b.fullAcct(status.Account.Acct)
+	export := b.exportThread(acct, b.fetchThread(ctx, parent))
+	asJSON := len(args) > 0 && strings.EqualFold(args[0], "json")
+	var data []byte
+	ext := "txt"
+	if asJSON {
+		data, err = json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			log.Printf("Failed to encode export: %v", err)
+			return b.catalog.message(lang, "export.failed")
+		}
+		ext = "json"
+	} else {
+		data = []byte(export.text())
+	}
+	log.Printf("Exporting %d posts of thread %s for %s", len(export.Statuses), parent.ID, acct)
+
+	post := b.replyParams(status)
+	post.Visibility = "direct"
+	if b.config.ExportURL != "" {
+		link, err := b.saveExport(data, ext)
+		if err != nil {
+			log.Printf("Failed to save export: %v", err)
+			return b.catalog.message(lang, "export.failed")
+		}
+		text := fmt.Sprintf(b.catalog.message(lang, "export.link"), link)
+		b.postChain(ctx, status, post, status.ID, b.splitReply(text, b.replyLimit(status)))
+		return ""
+	}
+
+	attachment, err := b.backend.UploadMedia(ctx, data, fmt.Sprintf("thread-%s.%s", parent.ID, ext), "")
+	if err != nil {
+		// Most servers only take images, video and audio.
+		log.Printf("Failed to upload export, posting it instead: %v", err)
+		// Break up the handles so the participants are not mentioned in the direct message.
+		transcript := strings.ReplaceAll(export.text(), "@", "@\u200b")
+		text := b.catalog.message(lang, "export.inline") + "\n\n" + transcript
+		b.postChain(ctx, status, post, status.ID, b.splitReply(text, b.replyLimit(status)))
+		return ""
+	}
+	post.MediaIDs = []string{attachment.ID}
+	b.postChain(ctx, status, post, status.ID, []string{b.catalog.message(lang, "export.attached")})
+	return ""
+}
+
+// exportThread describes thread, newest first, as the bot would pass it to
+// the model when answering its newest post for acct.
+func (b *Bot) exportThread(acct string, thread []*models.Status) *threadExport {
+	persona := b.personas.active(acct)
+	model := b.personaModel(persona)
+	systemPrompt := b.systemPrompt(persona, b.promptVars(thread[0], persona))
+	stack := b.buildConversationStack(thread, model, systemPrompt, 0)
+
+	export := &threadExport{
+		Exported:      time.Now(),
+		Requester:     acct,
+		Model:         model,
+		ContextBudget: b.contextBudget(model, systemPrompt),
+	}
+	if persona != nil {
+		export.Persona = persona.Name
+	}
+	for i := len(thread) - 1; i >= 0; i-- {
+		s := thread[i]
+		e := exportedStatus{
+			ID:          s.ID,
+			URL:         s.URL,
+			Acct:        b.fullAcct(s.Account.Acct),
+			CreatedAt:   s.CreatedAt,
+			Visibility:  s.Visibility,
+			Attachments: len(s.MediaAttachments),
+			Tokens:      b.statusTokens(model, s),
+			InContext:   i < len(stack),
+		}
+		if b.visibleTo(s, acct) {
+			e.Text = statusText(s)
+		} else {
+			e.Withheld = true
+		}
+		export.Statuses = append(export.Statuses, e)
+	}
+	return export
+}
+
+// visibleTo reports whether acct can see status: it is public or unlisted,
+// or acct wrote it or is mentioned in it. Followers-only posts of others are
+// not, since the bot cannot tell who follows whom.
+func (b *Bot) visibleTo(status *models.Status, acct string) bool {
+	if status.Visibility == "public" || status.Visibility == "unlisted" || b.fullAcct(status.Account.Acct) == acct {
+		return true
+	}
+	return slices.ContainsFunc(status.Mentions, func(m *models.Mention) bool { return b.fullAcct(m.Acct) == acct })
+}
+
+// text renders the export as a plain text transcript, oldest post first.
+func (e *threadExport) text() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Thread exported for @%s on %s\n", e.Requester, e.Exported.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&sb, "Model: %s", e.Model)
+	if e.Persona != "" {
+		fmt.Fprintf(&sb, " (persona %s)", e.Persona)
+	}
+	fmt.Fprintf(&sb, ", context budget %d tokens\n", e.ContextBudget)
+	sb.WriteString("Posts marked [trimmed] are left out of the model's context.\n")
+	for _, s := range e.Statuses {
+		fmt.Fprintf(&sb, "\n--- @%s, %s, %s, %d tokens", s.Acct, s.CreatedAt, s.Visibility, s.Tokens)
+		if !s.InContext {
+			sb.WriteString(" [trimmed]")
+		}
+		if s.URL != "" {
+			sb.WriteString("\n" + s.URL)
+		}
+		sb.WriteString("\n")
+		if s.Withheld {
+			sb.WriteString("[not visible to you]\n")
+			continue
+		}
+		if s.Text != "" {
+			sb.WriteString(s.Text + "\n")
+		}
+		if s.Attachments > 0 {
+			fmt.Fprintf(&sb, "[attachments: %d]\n", s.Attachments)
+		}
+	}
+	return sb.String()
+}
+
+// saveExport writes data to a file with an unguessable name in EXPORT_DIR
+// and returns its link below EXPORT_URL.
+func (b *Bot) saveExport(data []byte, ext string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(id) + "." + ext
+	link := strings.TrimSuffix(b.config.ExportURL, "/") + "/" + name
+	if b.wouldDo("write export %s", name) {
+		return link, nil
+	}
+	if err := os.MkdirAll(b.config.ExportDir, 0o755); err != nil {
+		return "", err
+	}
+	return link, os.WriteFile(filepath.Join(b.config.ExportDir, name), data, 0o644)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// withFallback wraps complete so that when a model fails or returns nothing,
+// the request is retried with each of FALLBACK_MODELS in turn.
+func (b *Bot) withFallback(complete completeFunc) completeFunc {
+	return func(chatHistory []Message, model string) (*Completion, error) {
+		completion, err := complete(chatHistory, model)
+		tried := map[string]bool{model: true}
+		for _, next := range b.config.FallbackModels {
+			if err == nil && (completion.Content != "" || len(completion.ToolCalls) > 0) {
+				break
+			}
+			if tried[next] {
+				continue
+			}
+			tried[next] = true
+			if err == nil {
+				err = errors.New("empty response")
+			}
+			log.Printf("Model %s failed, falling back to %s: %v", model, next, err)
+			model = next
+			completion, err = complete(chatHistory, model)
+		}
+		return completion, err
+	}
+}
+
+// completeWithFallback is chatCompletion with the fallback models.
+func (b *Bot) completeWithFallback(ctx context.Context, chatHistory []Message, model string, params GenerationParams) (*Completion, error) {
+	return b.withFallback(func(chatHistory []Message, model string) (*Completion, error) {
+		return b.chatCompletion(ctx, chatHistory, model, params)
+	})(chatHistory, model)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	feedStateFile = "feeds_seen.json"
+	// feedSeenLimit is how many entry IDs are remembered per feed; feeds rarely list more.
+	feedSeenLimit      = 500
+	feedMaxBytes       = 5 << 20
+	defaultFeedPrompt  = `Write a short commentary on the article below for a social media post, in at most three sentences: what it is about and why it is interesting. Do not include the link or hashtags.`
+	defaultFeedPerRun  = 1
+	defaultFeedSummary = 2000
+)
+
+// Feed is an RSS or Atom feed the bot checks on a cron schedule, posting a
+// short commentary with the link for each new entry.
+type Feed struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Cron        string `json:"cron,omitempty"`
+	Prompt      string `json:"prompt,omitempty"`
+	Visibility  string `json:"visibility,omitempty"`
+	Model       string `json:"model,omitempty"`
+	Persona     string `json:"persona,omitempty"`
+	Language    string `json:"language,omitempty"`
+	SpoilerText string `json:"spoiler_text,omitempty"`
+	// MaxPerRun caps the entries posted per check; older new entries are skipped.
+	MaxPerRun int `json:"max_per_run,omitempty"`
+
+	spec *cronSpec
+}
+
+// feedEntry is an RSS item or Atom entry.
+type feedEntry struct {
+	ID      string
+	Title   string
+	Link    string
+	Summary string
+}
+
+func loadFeeds(file string) []*Feed {
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Printf("Failed to read feeds: %v", err)
+		return nil
+	}
+	var all []*Feed
+	if err := json.Unmarshal(data, &all); err != nil {
+		log.Printf("Failed to parse feeds: %v", err)
+		return nil
+	}
+
+	var feeds []*Feed
+	for _, f := range all {
+		if f.Cron == "" {
+			f.Cron = "@hourly"
+		}
+		spec, err := parseCron(f.Cron)
+		if err != nil {
+			log.Printf("Skipping feed %q: %v", f.Name, err)
+			continue
+		}
+		f.spec = spec
+		if f.Name == "" {
+			f.Name = f.URL
+		}
+		if f.Visibility == "" {
+			f.Visibility = "unlisted"
+		}
+		if f.Prompt == "" {
+			f.Prompt = defaultFeedPrompt
+		}
+		if f.MaxPerRun <= 0 {
+			f.MaxPerRun = defaultFeedPerRun
+		}
+		feeds = append(feeds, f)
+	}
+	return feeds
+}
+
+// feedState remembers which entries of each feed have been seen.
+type feedState struct {
+	mu   sync.Mutex
+	dir  dataDir
+	Seen map[string][]string `json:"seen"` // feed name -> entry IDs, oldest first
+}
+
+func newFeedState(dir dataDir) *feedState {
+	s := &feedState{dir: dir, Seen: map[string][]string{}}
+	if err := dir.load(feedStateFile, s); err != nil {
+		log.Printf("Failed to load feed state: %v", err)
+	}
+	return s
+}
+
+func (s *feedState) reset() {
+	s.Seen = map[string][]string{}
+}
+
+// unseen returns the entries not seen before, oldest first, and marks them
+// seen. The first time a feed is checked, its current entries are only
+// marked, so adding a feed does not flood the timeline with its backlog.
+func (s *feedState) unseen(feed string, entries []feedEntry) []feedEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.dir.sync(feedStateFile, s, s.reset)()
+
+	seen, known := s.Seen[feed]
+	isSeen := map[string]bool{}
+	for _, id := range seen {
+		isSeen[id] = true
+	}
+	var fresh []feedEntry
+	// Feeds list the newest entries first.
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !isSeen[entries[i].ID] {
+			isSeen[entries[i].ID] = true
+			seen = append(seen, entries[i].ID)
+			fresh = append(fresh, entries[i])
+		}
+	}
+	if len(seen) > feedSeenLimit {
+		seen = seen[len(seen)-feedSeenLimit:]
+	}
+	s.Seen[feed] = seen
+	if err := s.dir.save(feedStateFile, s); err != nil {
+		log.Printf("Failed to save feed state: %v", err)
+	}
+	if !known {
+		return nil
+	}
+	return fresh
+}
+
+// checkFeed posts commentary on up to MaxPerRun new entries of feed. Entries
+// beyond that are marked seen but not posted.
+func (b *Bot) checkFeed(ctx context.Context, feed *Feed) {
+	entries, err := b.fetchFeed(ctx, feed.URL)
+	if err != nil {
+		log.Printf("Failed to fetch feed %q: %v", feed.Name, err)
+		return
+	}
+	fresh := b.feedState.unseen(feed.Name, entries)
+	if len(fresh) > feed.MaxPerRun {
+		log.Printf("Feed %q has %d new entries, posting the latest %d", feed.Name, len(fresh), feed.MaxPerRun)
+		fresh = fresh[len(fresh)-feed.MaxPerRun:]
+	}
+	for _, entry := range fresh {
+		b.postFeedEntry(ctx, feed, entry)
+	}
+}
+
+func (b *Bot) postFeedEntry(ctx context.Context, feed *Feed, entry feedEntry) {
+	persona := b.personas.find(feed.Persona)
+	model := feed.Model
+	if model == "" {
+		model = b.personaModel(persona)
+	}
+
+	article := fmt.Sprintf("Title: %s\n\n%s", entry.Title, entry.Summary)
+	if b.config.PromptHardening {
+		article = bracketUntrusted(feed.Name, article)
+	}
+	chatHistory := []Message{
+		{Role: "system", ChatContent: []ChatContent{{Type: "text", Text: renderPrompt(b.personaSystemPrompt(persona), b.promptVars(nil, persona)) + "\n\n" + feed.Prompt}}},
+		{Role: "user", ChatContent: []ChatContent{{Type: "text", Text: article}}},
+	}
+	completion, err := b.completeWithFallback(ctx, chatHistory, model, b.configuredParams())
+	b.usage.record(b.fullAcct(b.config.BotAccountName), completion.Usage)
+	if err != nil {
+		log.Printf("Failed to write commentary on %s: %v", entry.Link, err)
+		return
+	}
+	if completion.Content == "" || b.moderateOutput(ctx, b.config.BotAccountName, completion.Content) {
+		log.Printf("Not posting feed entry %s: empty or flagged", entry.Link)
+		return
+	}
+
+	text := decorateReply(persona, b.fixEmoji(ctx, completion.Content)) + "\n\n" + entry.Link
+	post := &StatusPost{
+		ContentType: "text/markdown",
+		Visibility:  feed.Visibility,
+		Language:    feed.Language,
+		SpoilerText: b.autoContentWarning(feed.SpoilerText, feed.Language),
+	}
+	if b.postThread(ctx, post, "", "", b.splitReply(text, b.config.MaxChar)) != nil {
+		log.Printf("Posted feed entry %s", entry.Link)
+	}
+}
+
+func (b *Bot) fetchFeed(ctx context.Context, url string) ([]feedEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	resp, err := b.media.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, feedMaxBytes))
+	if err != nil {
+		return nil, err
+	}
+	return parseFeed(data)
+}
+
+// feedDoc covers RSS 2.0 (channel/item), RSS 1.0 (item at the root) and Atom (entry).
+type feedDoc struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+type atomEntry struct {
+	ID    string `xml:"id"`
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Summary string `xml:"summary"`
+	Content string `xml:"content"`
+}
+
+func parseFeed(data []byte) ([]feedEntry, error) {
+	var doc feedDoc
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = feedCharsetReader
+	dec.Strict = false
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var entries []feedEntry
+	for _, item := range append(doc.Channel.Items, doc.Items...) {
+		entry := feedEntry{ID: item.GUID, Title: strings.TrimSpace(item.Title), Link: strings.TrimSpace(item.Link)}
+		entry.Summary = feedSummary(item.Content, item.Description)
+		if entry.ID == "" {
+			entry.ID = entry.Link
+		}
+		entries = append(entries, entry)
+	}
+	for _, e := range doc.Entries {
+		entry := feedEntry{ID: e.ID, Title: strings.TrimSpace(e.Title)}
+		for _, link := range e.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				entry.Link = strings.TrimSpace(link.Href)
+				break
+			}
+		}
+		entry.Summary = feedSummary(e.Content, e.Summary)
+		if entry.ID == "" {
+			entry.ID = entry.Link
+		}
+		entries = append(entries, entry)
+	}
+
+	var valid []feedEntry
+	for _, entry := range entries {
+		if entry.ID != "" && entry.Link != "" {
+			valid = append(valid, entry)
+		}
+	}
+	return valid, nil
+}
+
+// feedSummary returns the plain text of the first non-empty field, which may be HTML.
+func feedSummary(fields ...string) string {
+	for _, field := range fields {
+		if text := htmlToText(field); text != "" {
+			if runes := []rune(text); len(runes) > defaultFeedSummary {
+				text = string(runes[:defaultFeedSummary]) + "…"
+			}
+			return text
+		}
+	}
+	return ""
+}
+
+// feedCharsetReader decodes the Latin-1 feeds encoding/xml cannot read on its own.
+func feedCharsetReader(label string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(label) {
+	case "iso-8859-1", "latin1", "latin-1", "windows-1252", "us-ascii":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+		}
+		return strings.NewReader(string(runes)), nil
+	}
+	return nil, fmt.Errorf("unsupported feed charset %q", label)
+}
+
+// runFeeds checks the feeds due at t.
+func (b *Bot) runFeeds(ctx context.Context, t time.Time) {
+	for _, feed := range b.feeds {
+		if feed.spec.matches(t) {
+			b.tasks.Add(1)
+			go func() {
+				defer b.tasks.Done()
+				b.checkFeed(ctx, feed)
+			}()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// acceptsFollowRequest applies FOLLOW_REQUEST_POLICY to a request from account:
+// "all" accepts everyone, "local" only accounts on the bot's own instance,
+// "domains" accounts on FOLLOW_REQUEST_DOMAINS (and their subdomains), and
+// "pending" leaves every request for a human to decide.
+func (b *Bot) acceptsFollowRequest(account *models.Account) bool {
+	switch b.config.FollowRequestPolicy {
+	case "all":
+		return true
+	case "local":
+		return !strings.Contains(account.Acct, "@")
+	case "domains":
+		_, domain, _ := strings.Cut(b.fullAcct(account.Acct), "@")
+		domain = strings.ToLower(domain)
+		for _, allowed := range b.config.FollowRequestDomains {
+			allowed = strings.ToLower(strings.TrimPrefix(allowed, "."))
+			if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b *Bot) handleFollowRequest(ctx context.Context, notif *models.Notification) {
+	if notif.Account != nil {
+		b.reviewFollowRequest(ctx, notif.Account)
+	}
+}
+
+// reviewFollowRequest accepts the request from account if the policy allows
+// it, then treats it like any new follower.
+func (b *Bot) reviewFollowRequest(ctx context.Context, account *models.Account) {
+	if !b.acceptsFollowRequest(account) {
+		log.Printf("Leaving follow request from %s pending", account.Acct)
+		return
+	}
+	if err := b.backend.AuthorizeFollowRequest(ctx, account.ID); err != nil {
+		log.Printf("Failed to accept follow request from %s: %v", account.Acct, err)
+		return
+	}
+	log.Printf("Accepted follow request from %s", account.Acct)
+	b.handleFollow(ctx, &models.Notification{Type: "follow", Account: account})
+}
+
+// reviewPendingFollowRequests applies the policy to requests that came in
+// while the bot was not running, or whose notifications were already cleared.
+func (b *Bot) reviewPendingFollowRequests(ctx context.Context) {
+	if b.config.FollowRequestPolicy == "pending" {
+		return
+	}
+	accounts, err := b.backend.FollowRequests(ctx, 80)
+	if err != nil {
+		log.Printf("Failed to fetch follow requests: %v", err)
+		return
+	}
+	for _, account := range accounts {
+		b.reviewFollowRequest(ctx, account)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// handleFollow welcomes a new follower and follows them back, as configured.
+func (b *Bot) handleFollow(ctx context.Context, notif *models.Notification) {
+	if notif.Account == nil || b.isBotAccount(notif.Account.Acct) {
+		return
+	}
+	if b.config.WelcomeDM {
+		b.sendWelcome(ctx, notif.Account)
+	}
+	if b.config.FollowBack {
+		if err := b.backend.Follow(ctx, notif.Account.ID, false); err != nil {
+			log.Printf("Failed to follow back %s: %v", notif.Account.Acct, err)
+		}
+	}
+}
+
+// welcomeText fills in the welcome template: WELCOME_MESSAGE if set, or the
+// catalog's follow.welcome. {name}, {acct} and {bot} are replaced with the
+// follower's display name and handle and the bot's handle.
+func (b *Bot) welcomeText(account *models.Account) string {
+	template := b.config.WelcomeMessage
+	if template == "" {
+		template = b.catalog.message("", "follow.welcome")
+	}
+	name := account.DisplayName
+	if name == "" {
+		name = account.Username
+	}
+	return strings.NewReplacer(
+		"{name}", name,
+		"{acct}", "@"+b.fullAcct(account.Acct),
+		"{bot}", "@"+b.fullAcct(b.config.BotAccountName),
+	).Replace(template)
+}
+
+func (b *Bot) sendWelcome(ctx context.Context, account *models.Account) {
+	_, err := b.backend.PostStatus(ctx, &StatusPost{
+		Text:        "@" + b.fullAcct(account.Acct) + " " + b.welcomeText(account),
+		Visibility:  "direct",
+		ContentType: "text/markdown",
+	})
+	if err != nil {
+		log.Printf("Failed to send welcome message to %s: %v", account.Acct, err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// forgetmeCommand deletes what the bot keeps about the sender: usage
+// records, persona selection, the records of the posts it answered, replies
+// to them still waiting to be posted, and archived conversations, with their
+// posts in the archived conversations of others replaced. Blocks and
+// cooldowns are kept, since they exist to stop abuse. The confirmation is
+// sent as a direct message.
+func forgetmeCommand(ctx context.Context, b *Bot, status *models.Status, args []string) string {
+	acct := b.fullAcct(status.Account.Acct)
+	lang := status.Language
+
+	days := b.usage.forget(acct)
+	b.personas.selectFor(acct, nil)
+	b.recent.forget(acct)
+	records := b.replies.forget(acct)
+	queued := b.outbox.forget(func(e *outboxEntry) bool { return b.addressedTo(e.Prefix, acct) })
+	conversations, redacted, err := b.archive.forget(acct)
+	log.Printf("Forgot %s: usage on %d days, %d reply records, %d queued replies, %d archived conversations, %d redacted",
+		acct, days, records, queued, conversations, redacted)
+
+	text := fmt.Sprintf(b.catalog.message(lang, "forget.done"), days, conversations)
+	if err != nil {
+		log.Printf("Failed to remove %s from the archive: %v", acct, err)
+		text = b.catalog.message(lang, "forget.failed")
+	}
+	post := b.replyParams(status)
+	post.Visibility = "direct"
+	b.postChain(ctx, status, post, status.ID, b.splitReply(text, b.replyLimit(status)))
+	return ""
+}
+
+// addressedTo reports whether prefix, the mentions a post starts with,
+// mentions acct.
+func (b *Bot) addressedTo(prefix, acct string) bool {
+	for _, field := range strings.Fields(prefix) {
+		if strings.HasPrefix(field, "@") && b.fullAcct(strings.TrimPrefix(field, "@")) == acct {
+			return true
+		}
+	}
+	return false
+}
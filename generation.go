@@ -0,0 +1,148 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// GenerationParams are the sampling settings and tools sent with a
+// completion request. Unset values are left to the provider's defaults.
+type GenerationParams struct {
+	Temperature      *float64
+	TopP             *float64
+	MaxTokens        int
+	FrequencyPenalty *float64
+	Stop             []string
+	Tools            []interface{}
+}
+
+// overrideKeys are the parameters users may set inline, as "key=value" words
+// right after the mentions, with the range each accepts.
+var overrideKeys = map[string]struct{ min, max float64 }{
+	"temp":              {0, 2},
+	"temperature":       {0, 2},
+	"top_p":             {0, 1},
+	"max_tokens":        {1, 1 << 20},
+	"frequency_penalty": {-2, 2},
+}
+
+// generationParams returns the configured parameters with the inline
+// overrides of status applied, if its author is allowed to make them.
+func (b *Bot) generationParams(acct string, status *models.Status) GenerationParams {
+	params := b.configuredParams()
+	if b.config.PollCreation {
+		params.Tools = append(params.Tools, pollToolDefinition)
+	}
+	if !b.mayOverride(acct) {
+		return params
+	}
+
+	overrides, rest := splitOverrides(leadingMentionsRe.ReplaceAllString(statusText(status), ""))
+	if word := strings.Fields(rest); len(word) > 0 {
+		if _, _, known, valid := parseOverride(word[0]); known && !valid {
+			log.Printf("Ignoring invalid override %s from %s", word[0], acct)
+		}
+	}
+	for key, v := range overrides {
+		switch key {
+		case "temp", "temperature":
+			params.Temperature = &v
+		case "top_p":
+			params.TopP = &v
+		case "max_tokens":
+			// Users may ask for shorter replies, not longer ones.
+			if params.MaxTokens == 0 || int(v) < params.MaxTokens {
+				params.MaxTokens = int(v)
+			}
+		case "frequency_penalty":
+			params.FrequencyPenalty = &v
+		}
+	}
+	return params
+}
+
+// configuredParams returns the sampling settings from the configuration, without tools.
+func (b *Bot) configuredParams() GenerationParams {
+	return GenerationParams{
+		Temperature:      b.config.Temperature,
+		TopP:             b.config.TopP,
+		MaxTokens:        b.config.MaxTokens,
+		FrequencyPenalty: b.config.FrequencyPenalty,
+		Stop:             b.config.Stop,
+	}
+}
+
+func (b *Bot) mayOverride(acct string) bool {
+	switch b.config.InlineOverrides {
+	case "all":
+		return true
+	case "admins":
+		return b.isAdmin(acct)
+	}
+	return false
+}
+
+// splitOverrides takes the leading valid "key=value" words off text. It
+// stops at the first word that is not one, which is left in the text.
+func splitOverrides(text string) (map[string]float64, string) {
+	overrides := map[string]float64{}
+	rest := strings.TrimLeftFunc(text, unicode.IsSpace)
+	for {
+		word, after := rest, ""
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			word, after = rest[:i], rest[i:]
+		}
+		key, value, _, valid := parseOverride(word)
+		if !valid {
+			return overrides, rest
+		}
+		overrides[key] = value
+		rest = strings.TrimLeftFunc(after, unicode.IsSpace)
+	}
+}
+
+// parseOverride reads a "key=value" word. known reports whether the key is
+// one of overrideKeys, and valid whether the value is a number in its range.
+func parseOverride(word string) (key string, value float64, known, valid bool) {
+	key, raw, ok := strings.Cut(word, "=")
+	key = strings.ToLower(key)
+	limits, known := overrideKeys[key]
+	if !ok || !known {
+		return key, 0, false, false
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	return key, value, true, err == nil && value >= limits.min && value <= limits.max
+}
+
+// apply adds the parameters to a chat completion request. Reasoning models
+// take max_completion_tokens and reject the sampling parameters.
+func (p GenerationParams) apply(request map[string]interface{}, reasoning bool) {
+	if len(p.Tools) > 0 {
+		request["tools"] = p.Tools
+	}
+	if reasoning {
+		if p.MaxTokens > 0 {
+			request["max_completion_tokens"] = p.MaxTokens
+		}
+		return
+	}
+	if p.Temperature != nil {
+		request["temperature"] = *p.Temperature
+	}
+	if p.TopP != nil {
+		request["top_p"] = *p.TopP
+	}
+	if p.MaxTokens > 0 {
+		request["max_tokens"] = p.MaxTokens
+	}
+	if p.FrequencyPenalty != nil {
+		request["frequency_penalty"] = *p.FrequencyPenalty
+	}
+	if len(p.Stop) > 0 {
+		request["stop"] = p.Stop
+	}
+}
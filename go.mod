@@ -7,11 +7,16 @@ require (
 	github.com/go-openapi/strfmt v0.23.0
 	github.com/joho/godotenv v1.5.1
 	github.com/owu-one/gotosocial-sdk v0.17.1-0.20241016190738-53779b926243
+	github.com/pkoukk/tiktoken-go v0.1.7
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
+	golang.org/x/image v0.21.0
+	golang.org/x/net v0.30.0
 	golang.org/x/time v0.7.0
 )
 
 require (
 	github.com/asaskevich/govalidator v0.0.0-20230301143203-a9d515a09cc2 // indirect
+	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/go-logr/logr v1.4.1 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/go-openapi/analysis v0.23.0 // indirect
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	spaceRe     = regexp.MustCompile(`[ \t\r\n]+`)
+	blankLineRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText converts status HTML into readable plain text: paragraphs are
+// separated by blank lines, links keep their URL, and mentions are written as
+// @user@domain.
+func htmlToText(content string) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return content
+	}
+	return nodeText(doc)
+}
+
+// nodeText converts an HTML node and its children into plain text.
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	writeNode(&sb, n, false)
+
+	lines := strings.Split(sb.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text := blankLineRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+func writeNode(sb *strings.Builder, n *html.Node, pre bool) {
+	switch n.Type {
+	case html.TextNode:
+		if pre {
+			sb.WriteString(n.Data)
+		} else {
+			sb.WriteString(spaceRe.ReplaceAllString(n.Data, " "))
+		}
+		return
+	case html.ElementNode:
+		switch n.DataAtom {
+		case atom.Br:
+			sb.WriteString("\n")
+			return
+		case atom.A:
+			sb.WriteString(linkText(n))
+			return
+		case atom.P, atom.Div, atom.Blockquote, atom.Ul, atom.Ol, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			sb.WriteString("\n\n")
+			defer sb.WriteString("\n\n")
+		case atom.Pre:
+			sb.WriteString("\n\n")
+			defer sb.WriteString("\n\n")
+			pre = true
+		case atom.Li:
+			sb.WriteString("\n- ")
+			defer sb.WriteString("\n")
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeNode(sb, c, pre)
+	}
+}
+
+// linkText renders an anchor as a mention, a hashtag, or its text followed by the URL.
+func linkText(n *html.Node) string {
+	href := attr(n, "href")
+	text := strings.TrimSpace(innerText(n))
+	classes := strings.Fields(attr(n, "class"))
+
+	if hasClass(classes, "hashtag") {
+		return "#" + strings.TrimPrefix(text, "#")
+	}
+	if hasClass(classes, "mention") {
+		name := strings.TrimPrefix(text, "@")
+		if u, err := url.Parse(href); err == nil && u.Host != "" && !strings.Contains(name, "@") {
+			name += "@" + u.Host
+		}
+		return "@" + name
+	}
+	if href == "" || text == href {
+		return text
+	}
+	// Long URLs are displayed truncated, with the scheme hidden.
+	if text == "" || strings.Contains(href, strings.TrimSuffix(text, "…")) {
+		return href
+	}
+	return text + " (" + href + ")"
+}
+
+func innerText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return spaceRe.ReplaceAllString(sb.String(), " ")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(classes []string, class string) bool {
+	for _, c := range classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
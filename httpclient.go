@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const maxRetries = 10
+
+// errAttemptTimeout cancels an attempt that ran out of time.
+var errAttemptTimeout = errors.New("timed out")
+
+// RetryPolicy configures the per-attempt timeout and retries of one backend.
+type RetryPolicy struct {
+	Name    string
+	Timeout time.Duration
+	Retries int
+	Backoff time.Duration
+	// RetryPost allows retrying non-idempotent requests, for backends where
+	// repeating a POST has no side effects beyond cost.
+	RetryPost bool
+}
+
+// validate replaces out-of-range settings with defaults, or clamps them to their range.
+func (p RetryPolicy) validate(defaultTimeout time.Duration) RetryPolicy {
+	if p.Timeout <= 0 {
+		log.Printf("Invalid %s timeout %v, using %v", p.Name, p.Timeout, defaultTimeout)
+		p.Timeout = defaultTimeout
+	}
+	if clamped := min(max(p.Retries, 0), maxRetries); clamped != p.Retries {
+		log.Printf("Invalid %s retry count %d, using %d", p.Name, p.Retries, clamped)
+		p.Retries = clamped
+	}
+	if p.Backoff < 0 {
+		p.Backoff = 0
+	}
+	return p
+}
+
+// TransportSettings configure how the connections of one backend are made.
+type TransportSettings struct {
+	// Proxy is an http, https or socks5 proxy URL, or "direct" to ignore
+	// HTTP_PROXY and HTTPS_PROXY, which apply if it is empty.
+	Proxy string
+	// CAFile is a PEM bundle of certificates trusted in addition to the system's.
+	CAFile             string
+	InsecureSkipVerify bool
+}
+
+// getEnvTransport reads the transport settings of the backend whose settings start with prefix.
+func getEnvTransport(prefix string) TransportSettings {
+	return TransportSettings{
+		Proxy:              getEnv(prefix+"PROXY", ""),
+		CAFile:             getEnv(prefix+"CA_FILE", ""),
+		InsecureSkipVerify: getEnvAsBool(prefix+"INSECURE_SKIP_VERIFY", false),
+	}
+}
+
+// transport returns the base transport for the settings.
+func (s TransportSettings) transport() (http.RoundTripper, error) {
+	if s == (TransportSettings{}) {
+		return http.DefaultTransport, nil
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	switch s.Proxy {
+	case "":
+	case "direct":
+		t.Proxy = nil
+	default:
+		proxy, err := url.Parse(s.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	if s.CAFile != "" || s.InsecureSkipVerify {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: s.InsecureSkipVerify}
+	}
+	if s.CAFile != "" {
+		pem, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", s.CAFile)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	return t, nil
+}
+
+func newHTTPClient(policy RetryPolicy, base http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: &retryTransport{base: base, policy: policy},
+	}
+}
+
+// retryTransport applies the policy's timeout to each attempt and retries
+// network errors, 429 and 5xx responses with exponential backoff. For
+// requests made with withStreamedResponse, the timeout covers the wait for
+// the response headers and then each wait for more of the body.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		ctx, cancel := context.WithCancelCause(req.Context())
+		timer := time.AfterFunc(t.policy.Timeout, func() { cancel(errAttemptTimeout) })
+		resp, err := t.base.RoundTrip(r.WithContext(ctx))
+		if err != nil && context.Cause(ctx) == errAttemptTimeout {
+			err = fmt.Errorf("%w after %v", errAttemptTimeout, t.policy.Timeout)
+		}
+
+		if attempt >= t.policy.Retries || !t.retryable(req, resp, err) {
+			if err != nil {
+				timer.Stop()
+				cancel(nil)
+				return nil, err
+			}
+			if streamed, _ := req.Context().Value(streamedKey{}).(bool); streamed {
+				timer.Reset(t.policy.Timeout)
+				resp.Body = &idleTimeoutBody{ReadCloser: resp.Body, ctx: ctx, timer: timer, idle: t.policy.Timeout, cancel: cancel}
+			} else {
+				resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: func() { timer.Stop(); cancel(nil) }}
+			}
+			return resp, nil
+		}
+
+		wait := t.policy.Backoff << attempt
+		if resp != nil {
+			if s, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+				wait = time.Duration(s) * time.Second
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			log.Printf("%s request to %s returned %d, retrying in %v", t.policy.Name, req.URL.Host, resp.StatusCode, wait)
+		} else {
+			log.Printf("%s request to %s failed: %v, retrying in %v", t.policy.Name, req.URL.Host, err, wait)
+		}
+		timer.Stop()
+		cancel(nil)
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (t *retryTransport) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	if req.Method == http.MethodPost && !t.policy.RetryPost {
+		return false
+	}
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// cancelOnClose releases the attempt's context once the body has been consumed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// streamedKey marks the context of requests whose response body is streamed.
+type streamedKey struct{}
+
+// withStreamedResponse returns a context for a request whose response body
+// arrives over a long time, such as a completion stream.
+func withStreamedResponse(ctx context.Context) context.Context {
+	return context.WithValue(ctx, streamedKey{}, true)
+}
+
+// idleTimeoutBody cancels the attempt's context if no data arrives within
+// idle, and releases it once the body has been consumed.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	timer  *time.Timer
+	idle   time.Duration
+	cancel context.CancelCauseFunc
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && context.Cause(b.ctx) == errAttemptTimeout {
+		return n, fmt.Errorf("%w: no data for %v", errAttemptTimeout, b.idle)
+	}
+	b.timer.Reset(b.idle)
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.timer.Stop()
+	b.cancel(nil)
+	return err
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+const fallbackLanguage = "en"
+
+//go:embed lang/*.json
+var builtinLangs embed.FS
+
+// LanguagePack holds the localized strings for a single language.
+type LanguagePack struct {
+	// Commands maps canonical command names to their localized aliases.
+	Commands map[string][]string `json:"commands"`
+	// Messages maps message keys to localized templates.
+	Messages map[string]string `json:"messages"`
+}
+
+// Catalog maps language codes (file names without extension) to their packs.
+// It is read-only once loaded.
+type Catalog struct {
+	packs map[string]*LanguagePack
+	// defaultLanguage is used for messages without a language, and before
+	// English for keys missing in a language.
+	defaultLanguage string
+}
+
+// loadCatalog reads the built-in language packs, then merges any packs found in langDir.
+func loadCatalog(langDir, defaultLanguage string) Catalog {
+	c := Catalog{packs: map[string]*LanguagePack{}, defaultLanguage: strings.ToLower(defaultLanguage)}
+	c.loadLanguagePacks(builtinLangs, "lang")
+	if langDir != "" {
+		if _, err := os.Stat(langDir); err == nil {
+			c.loadLanguagePacks(os.DirFS(langDir), ".")
+		}
+	}
+	return c
+}
+
+func (c Catalog) loadLanguagePacks(fsys fs.FS, dir string) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		log.Printf("Failed to list language packs: %v", err)
+		return
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			log.Printf("Failed to read language pack %s: %v", file, err)
+			continue
+		}
+		var pack LanguagePack
+		if err := json.Unmarshal(data, &pack); err != nil {
+			log.Printf("Failed to parse language pack %s: %v", file, err)
+			continue
+		}
+		lang := strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))
+		c.mergeLanguagePack(lang, &pack)
+	}
+}
+
+func (c Catalog) mergeLanguagePack(lang string, pack *LanguagePack) {
+	existing, ok := c.packs[lang]
+	if !ok {
+		c.packs[lang] = pack
+		return
+	}
+	if existing.Commands == nil {
+		existing.Commands = map[string][]string{}
+	}
+	for name, aliases := range pack.Commands {
+		existing.Commands[name] = aliases
+	}
+	if existing.Messages == nil {
+		existing.Messages = map[string]string{}
+	}
+	for key, msg := range pack.Messages {
+		existing.Messages[key] = msg
+	}
+}
+
+// resolveCommand maps a command name or any localized alias to its canonical name.
+func (c Catalog) resolveCommand(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if _, ok := commands[name]; ok {
+		return name, true
+	}
+	for _, pack := range c.packs {
+		for canonical, aliases := range pack.Commands {
+			for _, alias := range aliases {
+				if _, ok := commands[canonical]; ok && strings.ToLower(alias) == name {
+					return canonical, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// message returns the template for key in lang, falling back to the base
+// language (e.g. "zh" for "zh-TW"), then to the default language, then to
+// English, then to the key itself. An empty lang is the default language.
+func (c Catalog) message(lang, key string) string {
+	lang = strings.ToLower(lang)
+	base, _, _ := strings.Cut(lang, "-")
+	defaultBase, _, _ := strings.Cut(c.defaultLanguage, "-")
+	for _, l := range []string{lang, base, c.defaultLanguage, defaultBase, fallbackLanguage} {
+		if pack, ok := c.packs[l]; ok {
+			if msg, ok := pack.Messages[key]; ok {
+				return msg
+			}
+		}
+	}
+	return key
+}
+
+// commandAliases returns the aliases of a command in the given language, if any.
+func (c Catalog) commandAliases(lang, name string) []string {
+	pack, ok := c.packs[strings.ToLower(lang)]
+	if !ok {
+		return nil
+	}
+	return pack.Commands[name]
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+	_ "golang.org/x/image/webp"
+)
+
+// maxImagePixels caps the size of images decoded for re-encoding, since
+// decoding takes memory in proportion to it. Larger images are sent as they
+// are, if they fit the byte budget.
+const maxImagePixels = 40_000_000
+
+// maxImageBytes caps image downloads. The byte budget applies to the image
+// as sent, after it has been shrunk.
+const maxImageBytes = 32 << 20
+
+// supportedImageTypes are the formats vision models accept.
+var supportedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func isValidImageAttachment(attachment *models.Attachment) bool {
+	return imageSource(attachment) != ""
+}
+
+// imageSource returns where to fetch an attachment's image from, or "" if it
+// has none: the file itself for images, and the still preview for GIFs the
+// server converted to video.
+func imageSource(attachment *models.Attachment) string {
+	switch attachment.Type {
+	case "image":
+		return attachment.URL
+	case "gifv":
+		return attachment.PreviewURL
+	case "unknown":
+		// Remote media the server has not processed; go by the file name.
+		if u, err := url.Parse(attachment.RemoteURL); err == nil && supportedImageTypes[mime.TypeByExtension(path.Ext(u.Path))] {
+			return attachment.RemoteURL
+		}
+	}
+	return ""
+}
+
+// selectImages downloads the images of a thread that will be sent to the
+// model, newest first, within MAX_IMAGES_PER_REQUEST and IMAGE_BYTE_BUDGET
+// and following the SENSITIVE_MEDIA policy. It maps attachment IDs to data URLs.
+func (b *Bot) selectImages(ctx context.Context, stack []*models.Status) map[string]string {
+	images := map[string]string{}
+	budget := b.config.ImageByteBudget
+	for _, status := range stack {
+		for _, attachment := range status.MediaAttachments {
+			if len(images) >= b.config.MaxImagesPerRequest {
+				return images
+			}
+			if !isValidImageAttachment(attachment) || !b.sensitiveAllowed(status, attachment) {
+				continue
+			}
+			if b.config.ImageByteBudget > 0 && budget <= 0 {
+				return images
+			}
+			imageURL := b.imageDataURL(ctx, attachment)
+			if imageURL == "" {
+				continue
+			}
+			if budget > 0 && len(imageURL) > budget {
+				log.Printf("Skipping attachment %s: %d bytes left in the image budget", attachment.ID, budget)
+				continue
+			}
+			budget -= len(imageURL)
+			images[attachment.ID] = imageURL
+		}
+	}
+	return images
+}
+
+// sensitiveAllowed applies SENSITIVE_MEDIA to the attachments of statuses
+// marked sensitive: "include" sends them, "skip" never does, and "described"
+// only sends those with alt text.
+func (b *Bot) sensitiveAllowed(status *models.Status, attachment *models.Attachment) bool {
+	if !status.Sensitive {
+		return true
+	}
+	switch b.config.SensitiveMedia {
+	case "include":
+		return true
+	case "described":
+		return attachment.Description != ""
+	}
+	return false
+}
+
+// attachmentContent returns the selected images of status to send to the
+// model, and notes in lang standing in for the attachments that are not
+// sent, with their alt text where the author wrote one.
+func attachmentContent(catalog Catalog, lang string, status *models.Status, selected map[string]string) (images []ChatContent, notes string) {
+	for _, attachment := range status.MediaAttachments {
+		imageURL, ok := selected[attachment.ID]
+		if !ok {
+			notes += "\n" + attachmentNote(catalog, lang, attachment)
+			continue
+		}
+		images = append(images, ChatContent{
+			Type: "image_url",
+			ImageURL: &ImageContent{
+				URL: imageURL,
+			},
+		})
+	}
+	return images, notes
+}
+
+func attachmentNote(catalog Catalog, lang string, attachment *models.Attachment) string {
+	if attachment.Description != "" {
+		return fmt.Sprintf(catalog.message(lang, "attachment.described"), attachment.Type, attachment.Description)
+	}
+	return fmt.Sprintf(catalog.message(lang, "attachment.omitted"), attachment.Type, path.Base(attachment.URL))
+}
+
+// imageDataURL downloads an attachment's image and returns it as a data URL
+// for the model, or "" if it cannot be fetched, is not a supported image or
+// is larger than maxImageBytes.
+func (b *Bot) imageDataURL(ctx context.Context, attachment *models.Attachment) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageSource(attachment), nil)
+	if err != nil {
+		log.Printf("Failed to fetch image: %v", err)
+		return ""
+	}
+	resp, err := b.media.Do(req)
+	if err != nil {
+		log.Printf("Failed to fetch image: %v", err)
+		return ""
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		log.Printf("Failed to read image: %v", err)
+		return ""
+	}
+	if len(data) > maxImageBytes {
+		log.Printf("Skipping attachment %s: larger than %d bytes", attachment.ID, maxImageBytes)
+		return ""
+	}
+
+	contentType := imageContentType(resp.Header.Get("Content-Type"), data)
+	if !supportedImageTypes[contentType] {
+		log.Printf("Skipping attachment %s of unsupported type %q", attachment.ID, contentType)
+		return ""
+	}
+	data, contentType = b.prepareImage(data, contentType)
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// imageContentType identifies an image by its content, falling back to the
+// declared Content-Type for formats that cannot be sniffed.
+func imageContentType(header string, data []byte) string {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if sniffed != "application/octet-stream" {
+		return sniffed
+	}
+	declared, _, _ := mime.ParseMediaType(header)
+	return declared
+}
+
+// prepareImage shrinks an image to fit IMAGE_MAX_DIMENSION and re-encodes it
+// as JPEG at IMAGE_QUALITY, so that phone photos do not bloat requests. GIFs
+// are always reduced to their first frame. JPEGs that already fit, images
+// over maxImagePixels and images that cannot be decoded are passed through.
+func (b *Bot) prepareImage(data []byte, contentType string) ([]byte, string) {
+	maxDim := b.config.ImageMaxDimension
+	if maxDim <= 0 && contentType != "image/gif" {
+		return data, contentType
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Failed to decode image, sending it as is: %v", err)
+		return data, contentType
+	}
+	if format == "jpeg" && config.Width <= maxDim && config.Height <= maxDim {
+		return data, contentType
+	}
+	if config.Width*config.Height > maxImagePixels {
+		log.Printf("Not re-encoding %dx%d %s image over %d pixels, sending it as is", config.Width, config.Height, format, maxImagePixels)
+		return data, contentType
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Failed to decode image, sending it as is: %v", err)
+		return data, contentType
+	}
+	bounds := img.Bounds()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(img, maxDim), &jpeg.Options{Quality: b.config.ImageQuality}); err != nil {
+		log.Printf("Failed to encode image, sending it as is: %v", err)
+		return data, contentType
+	}
+	log.Printf("Re-encoded %dx%d %s image from %d to %d bytes", bounds.Dx(), bounds.Dy(), format, len(data), buf.Len())
+	return buf.Bytes(), "image/jpeg"
+}
+
+// downscale resizes src by area averaging so its longer side is at most
+// maxDim (if positive), flattening any transparency onto white since JPEG
+// has none.
+func downscale(src image.Image, maxDim int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if maxDim > 0 && (w > maxDim || h > maxDim) {
+		if w >= h {
+			dw, dh = maxDim, max(1, h*maxDim/w)
+		} else {
+			dw, dh = max(1, w*maxDim/h), maxDim
+		}
+	}
+
+	// Premultiplied channel sums and pixel counts per destination pixel.
+	sums := make([][4]uint64, dw*dh)
+	counts := make([]uint64, dw*dh)
+	for y := 0; y < h; y++ {
+		row := y * dh / h * dw
+		for x := 0; x < w; x++ {
+			i := row + x*dw/w
+			r, g, b, a := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			sums[i][0] += uint64(r)
+			sums[i][1] += uint64(g)
+			sums[i][2] += uint64(b)
+			sums[i][3] += uint64(a)
+			counts[i]++
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for i, s := range sums {
+		n := counts[i]
+		background := 0xffff - s[3]/n
+		dst.SetRGBA64(i%dw, i/dw, color.RGBA64{
+			R: uint16(s[0]/n + background),
+			G: uint16(s[1]/n + background),
+			B: uint16(s[2]/n + background),
+			A: 0xffff,
+		})
+	}
+	return dst
+}
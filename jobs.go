@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const (
+	jobMention = "mention"
+	jobStatus  = "status"
+	// jobWait is how long a worker waits for a job before checking for shutdown.
+	jobWait = 5 * time.Second
+)
+
+// job is a notification handed from the poller to a worker.
+type job struct {
+	ID           string               `json:"id"`
+	Kind         string               `json:"kind"`
+	Attempts     int                  `json:"attempts"`
+	Notification *models.Notification `json:"notification"`
+}
+
+// jobQueue is a reliable queue in Redis. Pending jobs are in the list
+// QUEUE_NAME:jobs. A worker moves the job it takes to QUEUE_NAME:active and
+// records a lease in QUEUE_NAME:leases, and removes both when done. Jobs
+// whose lease runs out, because their worker crashed or hung, are put back.
+type jobQueue struct {
+	redis *redisClient
+	name  string
+}
+
+func newJobQueue(rawURL, name string) (*jobQueue, error) {
+	redis, err := newRedisClient(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid QUEUE_URL: %w", err)
+	}
+	return &jobQueue{redis: redis, name: name}, nil
+}
+
+// clone returns a queue with its own connection, for a worker to block on.
+func (q *jobQueue) clone() *jobQueue {
+	return &jobQueue{redis: q.redis.clone(), name: q.name}
+}
+
+func (q *jobQueue) key(suffix string) string {
+	return q.name + ":" + suffix
+}
+
+func (q *jobQueue) push(ctx context.Context, j *job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	_, err = q.redis.do(ctx, "LPUSH", q.key("jobs"), string(data))
+	return err
+}
+
+// next waits up to wait for a job and takes it for lease. It returns nil if
+// there was none.
+func (q *jobQueue) next(ctx context.Context, wait, lease time.Duration) (*job, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, wait+redisTimeout)
+	defer cancel()
+	reply, err := q.redis.do(ctx, "BLMOVE", q.key("jobs"), q.key("active"), "RIGHT", "LEFT", strconv.Itoa(int(wait.Seconds())))
+	if err != nil || reply == nil {
+		return nil, "", err
+	}
+	raw, _ := reply.(string)
+	var j job
+	if err := json.Unmarshal([]byte(raw), &j); err != nil || j.Notification == nil {
+		log.Printf("Dropping malformed job %q", raw)
+		q.redis.do(ctx, "LREM", q.key("active"), "1", raw)
+		return nil, "", nil
+	}
+	if _, err := q.redis.do(ctx, "HSET", q.key("leases"), j.ID, strconv.FormatInt(time.Now().Add(lease).Unix(), 10)); err != nil {
+		log.Printf("Failed to record the lease of job %s: %v", j.ID, err)
+	}
+	return &j, raw, nil
+}
+
+// done removes a finished job.
+func (q *jobQueue) done(ctx context.Context, raw, id string) {
+	if _, err := q.redis.do(ctx, "LREM", q.key("active"), "1", raw); err != nil {
+		log.Printf("Failed to remove finished job %s: %v", id, err)
+		return
+	}
+	q.redis.do(ctx, "HDEL", q.key("leases"), id)
+}
+
+// requeueExpired puts jobs whose lease ran out back at the head of the queue,
+// or drops them after maxAttempts. Jobs taken by a worker that has not yet
+// recorded a lease are given one.
+func (q *jobQueue) requeueExpired(ctx context.Context, lease time.Duration, maxAttempts int) {
+	reply, err := q.redis.do(ctx, "LRANGE", q.key("active"), "0", "-1")
+	if err != nil {
+		log.Printf("Failed to list active jobs: %v", err)
+		return
+	}
+	active, _ := reply.([]any)
+	now := time.Now()
+	for _, item := range active {
+		raw, _ := item.(string)
+		var j job
+		if err := json.Unmarshal([]byte(raw), &j); err != nil {
+			continue
+		}
+		reply, err := q.redis.do(ctx, "HGET", q.key("leases"), j.ID)
+		if err != nil {
+			log.Printf("Failed to get the lease of job %s: %v", j.ID, err)
+			return
+		}
+		deadline, ok := reply.(string)
+		if !ok {
+			q.redis.do(ctx, "HSETNX", q.key("leases"), j.ID, strconv.FormatInt(now.Add(lease).Unix(), 10))
+			continue
+		}
+		if unix, _ := strconv.ParseInt(deadline, 10, 64); now.Unix() < unix {
+			continue
+		}
+
+		// Whoever removes the job first owns it, should a worker finish it just now.
+		if n, err := q.redis.do(ctx, "LREM", q.key("active"), "1", raw); err != nil || n != int64(1) {
+			continue
+		}
+		q.redis.do(ctx, "HDEL", q.key("leases"), j.ID)
+		j.Attempts++
+		if j.Attempts >= maxAttempts {
+			log.Printf("Dropping %s job %s after %d attempts", j.Kind, j.ID, j.Attempts)
+			continue
+		}
+		log.Printf("Requeueing %s job %s, whose worker did not finish it in time", j.Kind, j.ID)
+		data, _ := json.Marshal(&j)
+		if _, err := q.redis.do(ctx, "RPUSH", q.key("jobs"), string(data)); err != nil {
+			log.Printf("Failed to requeue job %s: %v", j.ID, err)
+		}
+	}
+}
+
+// answer answers a mention or a subscribed post: on a worker with QUEUE_URL
+// set, or here if there is no queue or it cannot be reached.
+func (b *Bot) answer(ctx context.Context, kind string, notif *models.Notification) {
+	if b.jobs != nil {
+		err := b.jobs.push(ctx, &job{ID: notif.ID, Kind: kind, Notification: notif})
+		if err == nil {
+			log.Printf("Queued %s %s for a worker", kind, notif.ID)
+			return
+		}
+		log.Printf("Failed to queue %s %s, handling it here: %v", kind, notif.ID, err)
+	}
+	b.runJob(ctx, kind, notif)
+}
+
+func (b *Bot) runJob(ctx context.Context, kind string, notif *models.Notification) {
+	switch kind {
+	case jobMention:
+		b.processNotification(ctx, notif)
+	case jobStatus:
+		b.handleStatus(ctx, notif)
+	}
+}
+
+// work runs QUEUE_WORKERS workers answering the jobs queued by the poller,
+// until the process receives SIGINT or SIGTERM. Jobs in progress then have
+// SHUTDOWN_TIMEOUT to finish. The outbox, dashboard and debug endpoint are
+// left to the poller.
+func (b *Bot) work() {
+	if b.jobs == nil {
+		log.Fatal("QUEUE_URL is not set")
+	}
+	stop, cancelStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelStop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop.Done()
+		log.Printf("Shutting down, waiting up to %v for work in progress", b.config.ShutdownTimeout)
+		time.AfterFunc(b.config.ShutdownTimeout, cancel)
+	}()
+
+	b.checkConnections(ctx)
+
+	workers := max(b.config.QueueWorkers, 1)
+	log.Printf("Running %d workers on queue %s", workers, b.config.QueueName)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.workJobs(ctx, stop, b.jobs.clone())
+		}()
+	}
+	wg.Wait()
+}
+
+// workJobs takes jobs from q one at a time until stop is done.
+func (b *Bot) workJobs(ctx, stop context.Context, q *jobQueue) {
+	for stop.Err() == nil {
+		j, raw, err := q.next(stop, jobWait, b.config.QueueLease)
+		if err != nil {
+			if stop.Err() == nil {
+				log.Printf("Failed to get a job: %v", err)
+				select {
+				case <-stop.Done():
+				case <-time.After(b.config.RetryBackoff):
+				}
+			}
+			continue
+		}
+		if j == nil {
+			continue
+		}
+		log.Printf("Working on %s job %s", j.Kind, j.ID)
+		jobCtx, cancel := context.WithTimeout(ctx, b.config.NotificationTimeout)
+		b.runJob(jobCtx, j.Kind, j.Notification)
+		cancel()
+		q.done(ctx, raw, j.ID)
+	}
+}
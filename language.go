@@ -0,0 +1,155 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const replyLanguagePrompt = "\n\nThe user is writing in %s. Reply in %s unless they ask for another language."
+
+var languageNames = map[string]string{
+	"ar": "Arabic", "de": "German", "el": "Greek", "en": "English", "es": "Spanish",
+	"fr": "French", "he": "Hebrew", "hi": "Hindi", "it": "Italian", "ja": "Japanese",
+	"ko": "Korean", "nl": "Dutch", "pt": "Portuguese", "ru": "Russian", "th": "Thai",
+	"uk": "Ukrainian", "zh": "Chinese",
+}
+
+// stopwords are frequent short words that tell languages written in Latin script apart.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "you", "to", "of", "what", "how", "this", "that", "it", "for", "with", "not", "can", "do", "does", "my"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "du", "ein", "eine", "zu", "mit", "was", "wie", "auch", "es", "sie", "den", "auf"},
+	"fr": {"le", "les", "et", "est", "je", "tu", "vous", "une", "un", "des", "pas", "que", "qui", "pour", "dans", "ce", "avec", "sur", "c'est"},
+	"es": {"el", "los", "las", "y", "es", "que", "en", "una", "por", "para", "con", "qué", "cómo", "yo", "tú", "está", "pero", "muy"},
+	"it": {"il", "lo", "che", "è", "di", "per", "non", "sono", "come", "cosa", "ciao", "mi", "ti", "gli", "della", "questo"},
+	"pt": {"os", "as", "é", "um", "uma", "com", "não", "você", "eu", "isso", "está", "do", "da", "mas", "muito", "obrigado"},
+	"nl": {"het", "een", "en", "niet", "ik", "je", "jij", "wat", "hoe", "van", "op", "met", "dat", "voor", "zijn", "maar"},
+}
+
+var (
+	mentionOrTagRe = regexp.MustCompile(`[@#][\w.@-]+`)
+	latinWordRe    = regexp.MustCompile(`[\p{Latin}']+`)
+)
+
+// languageName returns the English name of a language code, or the code itself.
+func languageName(code string) string {
+	if name, ok := languageNames[baseLanguage(code)]; ok {
+		return name
+	}
+	return code
+}
+
+// baseLanguage returns the language of a code without its region, e.g. "zh" for "zh-TW".
+func baseLanguage(code string) string {
+	base, _, _ := strings.Cut(strings.ToLower(code), "-")
+	return base
+}
+
+// detectLanguage guesses the language of text from its script, and for Latin
+// script from common words. It returns "" if it cannot tell.
+func detectLanguage(text string) string {
+	text = linkRe.ReplaceAllString(text, " ")
+	text = mentionOrTagRe.ReplaceAllString(text, " ")
+
+	counts := map[string]int{}
+	kana, han := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				counts["uk"] += 10
+			}
+			counts["ru"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts["he"]++
+		case unicode.Is(unicode.Greek, r):
+			counts["el"]++
+		case unicode.Is(unicode.Thai, r):
+			counts["th"]++
+		case unicode.Is(unicode.Devanagari, r):
+			counts["hi"]++
+		}
+	}
+	// Japanese mixes kanji with kana; Chinese has no kana.
+	if kana > 0 && kana*10 >= kana+han {
+		counts["ja"] = kana + han
+	} else {
+		counts["zh"] = han + kana
+	}
+	if counts["uk"] > counts["ru"] {
+		counts["ru"] = 0
+	} else {
+		counts["uk"] = 0
+	}
+	// Latin words count once each, since one of them weighs about as much as a CJK character.
+	words := latinWordRe.FindAllString(strings.ToLower(text), -1)
+
+	best, bestCount := "", 0
+	for lang, n := range counts {
+		if n > bestCount || (n == bestCount && lang < best) {
+			best, bestCount = lang, n
+		}
+	}
+	if bestCount > len(words) {
+		return best
+	}
+	return detectLatinLanguage(words)
+}
+
+// detectLatinLanguage picks the language whose common words occur most often
+// in words, if at least two occur and no other language is as likely.
+func detectLatinLanguage(words []string) string {
+	scores := map[string]int{}
+	for _, word := range words {
+		for lang, list := range stopwords {
+			for _, stopword := range list {
+				if word == stopword {
+					scores[lang]++
+					break
+				}
+			}
+		}
+	}
+	best, bestScore, tie := "", 0, false
+	for lang, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tie = lang, score, false
+		case score == bestScore:
+			tie = true
+		}
+	}
+	if bestScore < 2 || tie {
+		return ""
+	}
+	return best
+}
+
+// requestLanguage returns the language status is written in: the detected
+// one where it is clear, otherwise the one its author's client set.
+func (b *Bot) requestLanguage(status *models.Status) string {
+	detected := detectLanguage(statusText(status))
+	if detected == "" || detected == baseLanguage(status.Language) {
+		return status.Language
+	}
+	return detected
+}
+
+// replyLanguage returns the language of a generated reply, defaulting to the request's.
+func replyLanguage(response, requested string) string {
+	detected := detectLanguage(response)
+	if detected == "" || detected == baseLanguage(requested) {
+		return requested
+	}
+	return detected
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// urlWeight is what a link counts for towards the character limit, however long it is.
+const urlWeight = 23
+
+var (
+	countedURLRe     = regexp.MustCompile(`^https?://[^\s<>"]+[^\s<>".,;:!?)\]'"]`)
+	countedMentionRe = regexp.MustCompile(`^@([\w.-]*\w)@[\w.-]*\w`)
+)
+
+// statusLength counts text the way the server does when checking the
+// character limit: user-perceived characters rather than bytes, links at a
+// fixed weight, and only the username part of remote mentions.
+func statusLength(text string) int {
+	n := 0
+	for i := 0; i < len(text); {
+		size, weight := nextUnit(text, i)
+		i += size
+		n += weight
+	}
+	return n
+}
+
+// statusCut returns the longest prefix length, in bytes, of text that fits in
+// limit characters. It never cuts inside a character, link or mention, and
+// always keeps at least one of them so the text can make progress.
+func statusCut(text string, limit int) int {
+	n := 0
+	for i := 0; i < len(text); {
+		size, weight := nextUnit(text, i)
+		if n+weight > limit && i > 0 {
+			return i
+		}
+		i += size
+		n += weight
+	}
+	return len(text)
+}
+
+// nextUnit returns the size in bytes and the counted weight of the indivisible
+// piece of text starting at i: a link, a remote mention, or a character.
+func nextUnit(text string, i int) (size, weight int) {
+	wordStart := i == 0 || !isWordByte(text[i-1])
+	if wordStart {
+		if m := countedURLRe.FindString(text[i:]); m != "" {
+			return len(m), urlWeight
+		}
+		if m := countedMentionRe.FindStringSubmatch(text[i:]); m != nil {
+			return len(m[0]), utf8.RuneCountInString(m[1]) + 1
+		}
+	}
+	return graphemeSize(text[i:]), 1
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '@' || c == '/' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// graphemeSize approximates the length of the grapheme cluster at the start
+// of s, so that combining marks, variation selectors, skin tones, flags and
+// ZWJ emoji sequences stay together.
+func graphemeSize(s string) int {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == '\r' && len(s) > 1 && s[1] == '\n' {
+		return 2
+	}
+	if isRegionalIndicator(r) {
+		if next, n := utf8.DecodeRuneInString(s[size:]); isRegionalIndicator(next) {
+			return size + n
+		}
+		return size
+	}
+
+	for size < len(s) {
+		next, n := utf8.DecodeRuneInString(s[size:])
+		switch {
+		case next == '\u200d': // zero width joiner
+			size += n
+			if size < len(s) {
+				_, n = utf8.DecodeRuneInString(s[size:])
+				size += n
+			}
+		case isExtender(next):
+			size += n
+		default:
+			return size
+		}
+	}
+	return size
+}
+
+func isExtender(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		r >= 0xfe00 && r <= 0xfe0f || // variation selectors
+		r >= 0x1f3fb && r <= 0x1f3ff || // skin tone modifiers
+		r >= 0xe0020 && r <= 0xe007f // emoji tag sequences
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
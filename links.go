@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	maxLinksPerPost  = 2
+	maxLinkRedirects = 5
+	summarizePrompt  = `Summarize the web page in the user message in a few sentences, in the language with the code %q. Mention its title and what it is about, then its main points. Reply with the summary only.`
+)
+
+var linkRe = regexp.MustCompile(`https?://[^\s<>"()\[\]]+[^\s<>"()\[\].,;:!?'’”]`)
+
+// errForbiddenAddress is returned for links that resolve to addresses the bot must not reach.
+var errForbiddenAddress = errors.New("address not allowed")
+
+// newLinkClient returns an HTTP client for fetching user-supplied links. It
+// only connects to public addresses on the standard ports, checked at dial
+// time so that DNS rebinding and redirects cannot reach internal services.
+func newLinkClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(addrPort.Addr()) || (addrPort.Port() != 80 && addrPort.Port() != 443) {
+				return fmt.Errorf("%w: %s", errForbiddenAddress, address)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxLinkRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() &&
+		!netip.MustParsePrefix("100.64.0.0/10").Contains(addr) // carrier-grade NAT
+}
+
+// LinkedPage is the readable content of a fetched link.
+type LinkedPage struct {
+	URL   string
+	Title string
+	Text  string
+}
+
+// fetchPage downloads a link and extracts its readable text, within
+// LINK_MAX_BYTES and LINK_MAX_CHARS.
+func (b *Bot) fetchPage(ctx context.Context, link string) (*LinkedPage, error) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("unsupported link %q", link)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9")
+	req.Header.Set("User-Agent", "gpt-bot (+https://"+b.config.FediDomain+")")
+
+	resp, err := b.links.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", link, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(b.config.LinkMaxBytes)))
+	if err != nil {
+		return nil, err
+	}
+
+	page := &LinkedPage{URL: link}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		page.Title, page.Text = readableText(string(body))
+	case "text/plain", "text/markdown":
+		page.Text = string(body)
+	default:
+		return nil, fmt.Errorf("%s is %q, not a web page", link, mediaType)
+	}
+
+	if runes := []rune(page.Text); len(runes) > b.config.LinkMaxChars {
+		page.Text = string(runes[:b.config.LinkMaxChars]) + "…"
+	}
+	return page, nil
+}
+
+// readableText returns the title and main text of an HTML page, leaving out
+// scripts, navigation and other page furniture.
+func readableText(content string) (title, text string) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", ""
+	}
+
+	var main, body *html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode {
+				switch c.DataAtom {
+				case atom.Title:
+					if title == "" {
+						title = strings.TrimSpace(innerText(c))
+					}
+				case atom.Script, atom.Style, atom.Noscript, atom.Nav, atom.Header, atom.Footer, atom.Aside, atom.Form, atom.Svg, atom.Iframe, atom.Button:
+					n.RemoveChild(c)
+					c = next
+					continue
+				case atom.Article, atom.Main:
+					if main == nil {
+						main = c
+					}
+				case atom.Body:
+					body = c
+				}
+			}
+			walk(c)
+			c = next
+		}
+	}
+	walk(doc)
+
+	switch {
+	case main != nil:
+		return title, nodeText(main)
+	case body != nil:
+		return title, nodeText(body)
+	}
+	return title, nodeText(doc)
+}
+
+// linksIn returns the first few web links in the text of status.
+func linksIn(status *models.Status) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, link := range linkRe.FindAllString(statusText(status), -1) {
+		if !seen[link] && len(links) < maxLinksPerPost {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// linkedPages fetches the pages linked from status and formats them for
+// the model, shortening their text to fit in budget tokens. It returns them
+// with the tokens they take up.
+func (b *Bot) linkedPages(ctx context.Context, status *models.Status, model string, budget int) ([]string, int) {
+	if !b.config.LinkFetch {
+		return nil, 0
+	}
+	var pages []string
+	used := 0
+	for _, link := range linksIn(status) {
+		page, err := b.fetchPage(ctx, link)
+		if err != nil {
+			log.Printf("Failed to fetch linked page: %v", err)
+			continue
+		}
+		content := b.pageContent(page)
+		tokens := countTokens(model, content)
+		left := max(budget-used, 0)
+		if tokens > left {
+			log.Printf("Shortening linked page %s from %d tokens to fit the %d left in the context budget", page.URL, tokens, left)
+		}
+		for tokens > left && page.Text != "" {
+			// Cut the text in proportion to the excess, and a little more.
+			runes := []rune(page.Text)
+			page.Text = string(runes[:len(runes)*left/tokens*9/10])
+			content = b.pageContent(page)
+			tokens = countTokens(model, content)
+		}
+		if tokens > left {
+			continue
+		}
+		pages = append(pages, content)
+		used += tokens
+	}
+	return pages, used
+}
+
+// attachLinkedPages adds pages to the last message of the chat history,
+// which is the one for the status linking them.
+func attachLinkedPages(chatHistory []Message, pages []string) {
+	if len(chatHistory) < 2 {
+		return
+	}
+	last := &chatHistory[len(chatHistory)-1]
+	for _, page := range pages {
+		last.ChatContent = append(last.ChatContent, ChatContent{Type: "text", Text: page})
+	}
+}
+
+// pageContent formats a fetched page for the model, marked as untrusted if prompt hardening is on.
+func (b *Bot) pageContent(page *LinkedPage) string {
+	text := fmt.Sprintf("[Linked page: %s]\n%s\n\n%s", page.URL, page.Title, page.Text)
+	if b.config.PromptHardening {
+		return bracketUntrusted(page.URL, text)
+	}
+	return text
+}
+
+// summarizeCommand summarizes the page given as argument, or the first page
+// linked from the post it replies to.
+func summarizeCommand(ctx context.Context, b *Bot, status *models.Status, args []string) string {
+	var link string
+	for _, arg := range args {
+		if linkRe.MatchString(arg) {
+			link = linkRe.FindString(arg)
+			break
+		}
+	}
+	if link == "" && status.InReplyToID != "" {
+		parent, err := b.backend.GetStatus(ctx, status.InReplyToID)
+		if err != nil {
+			log.Printf("Failed to get status to summarize: %v", err)
+		} else if links := linksIn(parent); len(links) > 0 {
+			link = links[0]
+		}
+	}
+	if link == "" {
+		return b.catalog.message(status.Language, "summarize.none")
+	}
+
+	page, err := b.fetchPage(ctx, link)
+	if err != nil {
+		log.Printf("Failed to fetch page to summarize: %v", err)
+		return b.catalog.message(status.Language, "summarize.failed")
+	}
+
+	lang := status.Language
+	if lang == "" {
+		lang = fallbackLanguage
+	}
+	summary, _ := b.commandCompletion(ctx, status, []Message{
+		{Role: "system", ChatContent: []ChatContent{{Type: "text", Text: fmt.Sprintf(summarizePrompt, lang)}}},
+		{Role: "user", ChatContent: []ChatContent{{Type: "text", Text: b.pageContent(page)}}},
+	}, b.config.OpenAIModel)
+	return summary
+}
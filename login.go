@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	appName = "gpt-bot"
+	// oobRedirectURI has the server show the authorization code instead of redirecting.
+	oobRedirectURI = "urn:ietf:wg:oauth:2.0:oob"
+	// misskeyPermissions are what the Misskey backend needs.
+	misskeyPermissions = "read:account,write:notes,read:notifications,write:notifications,write:drive,read:following,write:following"
+)
+
+// loginCommand implements `gpt-bot login`: it obtains an access token for the
+// bot's account on FEDI_DOMAIN and saves it, with the app's credentials, to
+// the env file.
+func loginCommand(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	envFile := fs.String("env-file", ".env", "file to save the credentials to")
+	scopes := fs.String("scopes", "read write", "OAuth scopes to request")
+	fs.Parse(args)
+
+	config := loadConfig()
+	if config.FediDomain == "" {
+		return errors.New("FEDI_DOMAIN is not set")
+	}
+	gts, _, _ := newClients(config)
+	api := *gts.API
+	api.token = ""
+
+	ctx := context.Background()
+	in := bufio.NewReader(os.Stdin)
+	var settings map[string]string
+	var err error
+	if config.Backend == "misskey" {
+		settings, err = miAuthLogin(ctx, &api, in)
+	} else {
+		settings, err = oauthLogin(ctx, &api, in, config, *scopes)
+	}
+	if err != nil {
+		return err
+	}
+
+	config.AccessToken = settings["ACCESS_TOKEN"]
+	gts, _, _ = newClients(config)
+	account, err := newBackend(config, gts).VerifyCredentials(ctx)
+	if err != nil {
+		return fmt.Errorf("verify access token: %w", err)
+	}
+	fmt.Printf("Logged in as @%s\n", account.Acct)
+	if config.BotAccountName == "" {
+		settings["BOT_ACCOUNT_NAME"] = account.Acct
+	}
+
+	if err := updateEnvFile(*envFile, settings); err != nil {
+		return err
+	}
+	fmt.Printf("Saved the credentials to %s\n", *envFile)
+	return nil
+}
+
+// oauthLogin registers the app on a Mastodon-compatible server, unless
+// CLIENT_KEY and CLIENT_SECRET are already set, and walks the authorization
+// code flow.
+func oauthLogin(ctx context.Context, api *apiClient, in *bufio.Reader, config Config, scopes string) (map[string]string, error) {
+	clientID, clientSecret := config.ClientKey, config.ClientSecret
+	if clientID == "" || clientSecret == "" {
+		var app struct {
+			ClientID     string `json:"client_id"`
+			ClientSecret string `json:"client_secret"`
+		}
+		err := api.request(ctx, http.MethodPost, "/api/v1/apps", map[string]string{
+			"client_name":   appName,
+			"redirect_uris": oobRedirectURI,
+			"scopes":        scopes,
+		}, &app)
+		if err != nil {
+			return nil, fmt.Errorf("register app: %w", err)
+		}
+		clientID, clientSecret = app.ClientID, app.ClientSecret
+	}
+
+	authorize := url.URL{Scheme: "https", Host: api.domain, Path: "/oauth/authorize", RawQuery: url.Values{
+		"client_id":     {clientID},
+		"redirect_uri":  {oobRedirectURI},
+		"response_type": {"code"},
+		"scope":         {scopes},
+	}.Encode()}
+	fmt.Printf("Open this URL while logged in as the bot's account, and authorize the app:\n\n%s\n\n", authorize.String())
+	fmt.Print("Authorization code: ")
+	code, err := in.ReadString('\n')
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, fmt.Errorf("no authorization code entered: %v", err)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = api.request(ctx, http.MethodPost, "/oauth/token", map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          code,
+		"client_id":     clientID,
+		"client_secret": clientSecret,
+		"redirect_uri":  oobRedirectURI,
+		"scope":         scopes,
+	}, &token)
+	if err != nil {
+		return nil, fmt.Errorf("obtain access token: %w", err)
+	}
+	return map[string]string{
+		"CLIENT_KEY":    clientID,
+		"CLIENT_SECRET": clientSecret,
+		"ACCESS_TOKEN":  token.AccessToken,
+	}, nil
+}
+
+// miAuthLogin obtains an access token from a Misskey server with MiAuth,
+// which needs no app registration.
+func miAuthLogin(ctx context.Context, api *apiClient, in *bufio.Reader) (map[string]string, error) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	session := hex.EncodeToString(id)
+
+	authorize := url.URL{Scheme: "https", Host: api.domain, Path: "/miauth/" + session, RawQuery: url.Values{
+		"name":       {appName},
+		"permission": {misskeyPermissions},
+	}.Encode()}
+	fmt.Printf("Open this URL while logged in as the bot's account, and allow access:\n\n%s\n\n", authorize.String())
+	fmt.Print("Press Enter when done.")
+	in.ReadString('\n')
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Token string `json:"token"`
+	}
+	if err := api.request(ctx, http.MethodPost, "/api/miauth/"+session+"/check", map[string]string{}, &result); err != nil {
+		return nil, fmt.Errorf("obtain access token: %w", err)
+	}
+	if !result.OK || result.Token == "" {
+		return nil, errors.New("access was not granted")
+	}
+	return map[string]string{"ACCESS_TOKEN": result.Token}, nil
+}
+
+// updateEnvFile sets settings in the env file at path, replacing the lines
+// that already set them and keeping everything else, including comments.
+func updateEnvFile(path string, settings map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+	done := map[string]bool{}
+	for i, line := range lines {
+		key, _, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(key), "export "))
+		if value, set := settings[key]; ok && set && !done[key] {
+			lines[i] = key + "=" + value
+			done[key] = true
+		}
+	}
+	for _, key := range []string{"CLIENT_KEY", "CLIENT_SECRET", "ACCESS_TOKEN", "BOT_ACCOUNT_NAME"} {
+		if value, set := settings[key]; set && !done[key] {
+			lines = append(lines, key+"="+value)
+		}
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
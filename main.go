@@ -1,43 +1,85 @@
 package main
 
 import (
-	"encoding/base64"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/go-openapi/runtime"
-	"github.com/owu-one/gotosocial-sdk/client/accounts"
-	"github.com/owu-one/gotosocial-sdk/client/notifications"
-	"github.com/owu-one/gotosocial-sdk/client/statuses"
 	"github.com/owu-one/gotosocial-sdk/models"
 )
 
 func main() {
-	checkConnections()
+	if err := runCommand(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
 
+// run answers notifications until the process receives SIGINT or SIGTERM.
+// Work in progress then has SHUTDOWN_TIMEOUT to finish before it is cancelled.
+func (b *Bot) run() {
+	stop, cancelStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelStop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop.Done()
+		log.Printf("Shutting down, waiting up to %v for work in progress", b.config.ShutdownTimeout)
+		time.AfterFunc(b.config.ShutdownTimeout, cancel)
+	}()
+
+	b.checkConnections(ctx)
+	b.reviewPendingFollowRequests(ctx)
+	b.subscribe(ctx)
+	b.tasks.Add(1)
+	go func() {
+		defer b.tasks.Done()
+		b.runSchedules(ctx, stop.Done())
+	}()
+	go b.serveDashboard(stop)
+	go b.serveDebug(stop)
+
+	interval := b.config.PollInterval
 	for {
+		b.retryOutbox(ctx)
+		if b.jobs != nil {
+			b.jobs.requeueExpired(ctx, b.config.QueueLease, b.config.QueueMaxAttempts)
+		}
 		log.Printf("<%s> Polling for notifications...", time.Now().Format("2006-01-02 15:04:05"))
-		processNotifications()
-		time.Sleep(20 * time.Second)
+		if b.config.PollMode == "delta" {
+			interval = b.pollDelta(ctx, interval)
+		} else {
+			b.processNotifications(ctx)
+		}
+		select {
+		case <-stop.Done():
+			b.tasks.Wait()
+			return
+		case <-time.After(interval):
+		}
 	}
 }
 
-func checkConnections() {
-	_, err := gts.Client.Accounts.AccountVerify(accounts.NewAccountVerifyParams(), gts.Auth)
+func (b *Bot) checkConnections(ctx context.Context) {
+	_, err := b.backend.VerifyCredentials(ctx)
 	if err != nil {
-		log.Fatalf("GoToSocial Connection Error: %v", err)
+		log.Fatalf("Fediverse Connection Error: %v", err)
 		os.Exit(1)
 	}
-	log.Println("GoToSocial Connection: OK")
+	log.Println("Fediverse Connection: OK")
 
-	err = pingGPTService()
+	if _, ok := b.stubCompletion(b.config.OpenAIModel); ok {
+		return
+	}
+	err = b.pingGPTService(ctx)
 	if err != nil {
 		log.Fatalf("GPT Connection Error: %v", err)
 		os.Exit(1)
@@ -45,15 +87,14 @@ func checkConnections() {
 	log.Println("GPT Connection: OK")
 }
 
-func pingGPTService() error {
-	url := fmt.Sprintf("%s/chat/completions", config.OpenAIAPIURL)
-	payload := strings.NewReader(`{"model": "` + config.OpenAIModel + `", "messages": [{"role": "user", "content": "Ping"}]}`)
-
-	req, _ := http.NewRequest("POST", url, payload)
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+config.OpenAIAPIKey)
+func (b *Bot) pingGPTService(ctx context.Context) error {
+	payload := `{"model": "` + b.config.OpenAIModel + `", "messages": [{"role": "user", "content": "Ping"}]}`
+	req, err := b.newLLMRequest(ctx, b.llmURL("chat/completions", b.config.OpenAIModel), b.config.OpenAIModel, []byte(payload))
+	if err != nil {
+		return err
+	}
 
-	res, err := openAI.Do(req)
+	res, err := b.openAI.Do(req)
 	if err != nil {
 		return err
 	}
@@ -66,98 +107,323 @@ func pingGPTService() error {
 	return nil
 }
 
-func processNotifications() {
-	notifs, err := gts.Client.Notifications.Notifications(notifications.NewNotificationsParams(), gts.Auth)
+func (b *Bot) processNotifications(ctx context.Context) {
+	notifs, err := b.backend.Notifications(ctx, NotificationQuery{})
+	b.lastPoll.set(len(notifs), err)
 	if err != nil {
 		log.Printf("Failed to fetch notifications: %v", err)
 		return
 	}
+	if len(notifs) == 0 {
+		return
+	}
 
-	for _, notif := range notifs.Payload {
-		if notif.Type != "mention" {
-			continue
-		}
+	ids := make([]string, len(notifs))
+	for i, notif := range notifs {
+		b.handleNotification(ctx, notif)
+		ids[i] = notif.ID
+	}
 
-		processNotification(notif)
+	if err := b.backend.DismissNotifications(ctx, ids); err != nil {
+		log.Printf("Failed to dismiss notifications: %v", err)
 	}
+}
 
-	_, err = gts.Client.Notifications.ClearNotifications(notifications.NewClearNotificationsParams(), gts.Auth)
-	if err != nil {
-		log.Printf("Failed to clear notifications: %v", err)
+// handledNotificationTypes lists the notification types handleNotification acts on.
+var handledNotificationTypes = []string{"mention", "follow", "follow_request", "status", "favourite", reactionType}
+
+func (b *Bot) handleNotification(ctx context.Context, notif *models.Notification) {
+	ctx, cancel := context.WithTimeout(ctx, b.config.NotificationTimeout)
+	defer cancel()
+
+	if notif.Account != nil && b.blocked.blocked(b.fullAcct(notif.Account.Acct)) {
+		log.Printf("Ignoring %s notification %s from blocked account %s", notif.Type, notif.ID, notif.Account.Acct)
+		return
+	}
+	typ := notif.Type
+	if _, ok := reactionEmoji(notif); ok {
+		typ = reactionType
+	}
+	switch typ {
+	case "mention":
+		if !b.screenSpam(ctx, notif) && b.claimReply(ctx, notif) {
+			b.answer(ctx, jobMention, notif)
+		}
+	case "follow":
+		b.handleFollow(ctx, notif)
+	case "follow_request":
+		b.handleFollowRequest(ctx, notif)
+	case "status":
+		if b.claimReply(ctx, notif) {
+			b.answer(ctx, jobStatus, notif)
+		}
+	case "favourite", reactionType:
+		b.handleReaction(ctx, notif)
 	}
 }
 
-func processNotification(notif *models.Notification) {
-	stack := buildConversationStack(notif.Status)
-	chatHistory := buildChatHistory(stack)
+func (b *Bot) processNotification(ctx context.Context, notif *models.Notification) {
+	// Replies take their language from this copy of the status.
+	in := *notif.Status
+	status := &in
+	if b.config.MatchLanguage {
+		status.Language = b.requestLanguage(notif.Status)
+	}
+	if name, args, ok := b.parseCommand(status); ok {
+		b.handleCommand(ctx, status, name, args)
+		return
+	}
+
+	acct := b.fullAcct(status.Account.Acct)
+	persona := b.personas.active(acct)
+	model := b.personaModel(persona)
+	thread := b.fetchThread(ctx, status)
+	if b.declineCrowdedThread(ctx, status, thread) || b.endLongThread(ctx, status, thread) {
+		return
+	}
+	systemPrompt := b.systemPrompt(persona, b.promptVars(status, persona))
+	// Linked pages come out of the budget first, less the post linking them,
+	// which is always kept.
+	pages, pageTokens := b.linkedPages(ctx, status, model, b.contextBudget(model, systemPrompt)-b.statusTokens(model, status))
+	stack := b.buildConversationStack(thread, model, systemPrompt, pageTokens)
+	chatHistory := b.buildChatHistory(ctx, stack, persona, systemPrompt)
+	attachLinkedPages(chatHistory, pages)
+	b.screenInjections(ctx, chatHistory)
+	if b.config.MatchLanguage && status.Language != "" {
+		name := languageName(status.Language)
+		chatHistory[0].ChatContent[0].Text += fmt.Sprintf(replyLanguagePrompt, name, name)
+	}
+	if b.config.CWPolicy == "model" {
+		chatHistory[0].ChatContent[0].Text += cwPrompt
+	}
+	chatHistory[0].ChatContent[0].Text += b.emojiInstructions(ctx)
 	printChatHistory(chatHistory)
 
-	response := callGPT(chatHistory)
+	if b.moderateInput(ctx, acct, chatHistory) {
+		b.replyToStatus(ctx, status, b.moderationMessage(status.Language))
+		return
+	}
+
+	// Output moderation and proposed content warnings need the whole reply before anything is posted.
+	var draft *replyDraft
+	if b.config.StreamReplies && !b.config.ModerateOutput && b.config.CWPolicy != "model" && !b.config.DryRun {
+		draft = b.startDraft(ctx, status)
+	}
+
+	var completion *Completion
+	if draft != nil {
+		completion = b.streamGPT(ctx, chatHistory, model, b.generationParams(acct, status), draft)
+	} else {
+		completion = b.callGPT(ctx, chatHistory, model, b.generationParams(acct, status), status.Language)
+	}
+	b.usage.record(acct, completion.Usage)
+	response := completion.Content
+	var proposedCW string
+	if b.config.CWPolicy == "model" {
+		proposedCW, response = splitContentWarning(response)
+	}
+	response = b.fixEmoji(ctx, response)
+	poll := requestedPoll(completion.ToolCalls)
+	if poll != nil && response == "" {
+		response = poll.Question
+	}
 	if response == "" {
 		log.Println("Empty response from GPT service")
+		if draft != nil {
+			b.discardDraft(ctx, draft)
+		}
 		return
 	}
 
-	replyToStatus(notif.Status, response)
+	moderated := response
+	if poll != nil {
+		moderated += "\n" + strings.Join(poll.Options, "\n")
+	}
+	if b.moderateOutput(ctx, acct, moderated) {
+		response = b.moderationMessage(status.Language)
+		proposedCW = ""
+		poll = nil
+	}
+
+	if b.config.ArchiveConversations {
+		entry := ArchiveEntry{
+			Time:           time.Now(),
+			NotificationID: notif.ID,
+			StatusID:       status.ID,
+			Acct:           acct,
+			RequestModel:   model,
+			Messages:       chatHistory,
+			Response:       response,
+			ToolCalls:      completion.ToolCalls,
+			Usage:          completion.Usage,
+			Metadata:       completion.ResponseMetadata,
+		}
+		if persona != nil {
+			entry.Persona = persona.Name
+		}
+		b.archive.append(entry)
+	}
+
+	if b.config.MatchLanguage {
+		status.Language = replyLanguage(response, status.Language)
+		if draft != nil {
+			draft.reply.Language = status.Language
+		}
+	}
+	reply := decorateReply(persona, response)
+	recent := recentReply{
+		Time:      time.Now(),
+		Acct:      acct,
+		StatusURL: status.URL,
+		Request:   statusText(status),
+		Reply:     reply,
+		Model:     completion.Model,
+	}
+	if completion.Usage != nil {
+		recent.Tokens = completion.Usage.TotalTokens
+	}
+	b.recent.add(recent)
+	post := b.replyParams(status)
+	if post.SpoilerText == "" {
+		post.SpoilerText = proposedCW
+	}
+	switch {
+	case poll != nil:
+		if draft != nil {
+			b.discardDraft(ctx, draft)
+		}
+		b.replyWithPoll(ctx, status, post, reply, poll)
+	case draft != nil:
+		b.finishDraft(ctx, draft, reply)
+	default:
+		b.postChain(ctx, status, post, status.ID, b.splitReply(reply, b.replyLimit(status)))
+	}
+}
+
+// fetchThread returns status followed by its ancestors, newest first.
+func (b *Bot) fetchThread(ctx context.Context, status *models.Status) []*models.Status {
+	thread, err := b.fetchAncestors(ctx, status)
+	if err != nil {
+		log.Printf("Failed to get thread context, walking replies instead: %v", err)
+		thread = b.walkAncestors(ctx, status)
+	}
+	return thread
 }
 
-func buildConversationStack(status *models.Status) []*models.Status {
+// buildConversationStack returns the newest statuses of a thread, limited to
+// MAX_HISTORY_COUNT statuses and the model's token budget, less reserved
+// tokens taken up by other content.
+func (b *Bot) buildConversationStack(thread []*models.Status, model, systemPrompt string, reserved int) []*models.Status {
+	stack := thread
+	if len(stack) > b.config.MaxHistoryCount {
+		stack = stack[:b.config.MaxHistoryCount]
+	}
+	return b.trimStackToBudget(stack, model, b.contextBudget(model, systemPrompt)-reserved)
+}
+
+// fetchAncestors gets the whole reply chain in one call to the thread context endpoint.
+func (b *Bot) fetchAncestors(ctx context.Context, status *models.Status) ([]*models.Status, error) {
+	stack := []*models.Status{status}
+	if status.InReplyToID == "" {
+		return stack, nil
+	}
+
+	ancestors, _, err := b.backend.ThreadContext(ctx, status.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		stack = append(stack, ancestors[i])
+	}
+	return stack, nil
+}
+
+// walkAncestors follows InReplyToID one status at a time.
+func (b *Bot) walkAncestors(ctx context.Context, status *models.Status) []*models.Status {
 	stack := []*models.Status{status}
 	currentStatus := status
 
-	for len(stack) < config.MaxHistoryCount && currentStatus.InReplyToID != "" {
-		params := statuses.NewStatusGetParams().WithID(currentStatus.InReplyToID)
-		resp, err := gts.Client.Statuses.StatusGet(params, gts.Auth)
+	for len(stack) < b.config.MaxHistoryCount && currentStatus.InReplyToID != "" {
+		parent, err := b.backend.GetStatus(ctx, currentStatus.InReplyToID)
 		if err != nil {
 			log.Printf("Failed to get status: %v", err)
 			break
 		}
-		stack = append(stack, resp.Payload)
-		currentStatus = resp.Payload
+		stack = append(stack, parent)
+		currentStatus = parent
 	}
 
-	return trimStackToMaxChar(stack)
+	return stack
 }
 
-func trimStackToMaxChar(stack []*models.Status) []*models.Status {
-	totalChars := 0
-	for i := len(stack) - 1; i >= 0; i-- {
-		totalChars += len(stack[i].Content)
-		if totalChars > config.MaxHistoryChar {
-			return stack[i+1:]
-		}
+// statusText returns the plain text of a status: its source text for local
+// statuses, or its HTML content converted to text for remote ones.
+func statusText(status *models.Status) string {
+	if status.Text != "" {
+		return status.Text
 	}
-	return stack
+	return htmlToText(status.Content)
 }
 
-func buildChatHistory(stack []*models.Status) []Message {
+// systemPrompt returns the full system prompt used when answering as
+// persona, with its template filled in from vars.
+func (b *Bot) systemPrompt(persona *Persona, vars PromptVars) string {
+	systemPrompt := renderPrompt(b.personaSystemPrompt(persona), vars)
+	if b.config.PromptHardening {
+		systemPrompt += untrustedNotice
+	}
+	return systemPrompt
+}
+
+func (b *Bot) buildChatHistory(ctx context.Context, stack []*models.Status, persona *Persona, systemPrompt string) []Message {
 	chatHistory := []Message{
 		{
 			Role: "system",
 			ChatContent: []ChatContent{
 				{
 					Type: "text",
-					Text: config.SystemPrompt,
+					Text: systemPrompt,
 				},
 			},
 		},
 	}
 
-	botAcct := fmt.Sprintf("%s@%s", config.BotAccountName, config.FediDomain)
-
 	reversedStack := make([]*models.Status, len(stack))
 	for i, status := range stack {
 		reversedStack[len(stack)-1-i] = status
 	}
 
+	// Notes about attachments are in the language of the post being answered.
+	lang := ""
+	if len(stack) > 0 {
+		lang = stack[0].Language
+	}
+	names := b.displayNames(stack)
+	quotes := b.quotedStatuses(ctx, stack)
+	withQuotes := append([]*models.Status{}, stack...)
+	for _, status := range stack {
+		if quoted := quotes[status.ID]; quoted != nil {
+			withQuotes = append(withQuotes, quoted)
+		}
+	}
+	selected := b.selectImages(ctx, withQuotes)
 	for _, status := range reversedStack {
-		t := status.Text
-		if t == "" {
-			t = status.Content
+		t := b.normalizeMentions(status, statusText(status), names)
+		if !b.isBotAccount(status.Account.Acct) {
+			_, t = splitOverrides(t)
+			t = b.describeEmoji(ctx, status, t)
 		}
-		if t == "" {
+		quoted := quotes[status.ID]
+		if t == "" && len(status.MediaAttachments) == 0 && status.Poll == nil && quoted == nil {
 			continue
 		}
+		images, notes := attachmentContent(b.catalog, lang, status, selected)
+		t = strings.TrimSpace(t + notes + pollText(status.Poll))
+		if quoted != nil {
+			quotedImages, quotedNotes := attachmentContent(b.catalog, lang, quoted, selected)
+			t = strings.TrimSpace(t + "\n\n" + quoteText(quoted, quotedNotes+pollText(quoted.Poll)))
+			images = append(images, quotedImages...)
+		}
 		statusText := ChatContent{
 			Type: "text",
 			Text: t,
@@ -168,58 +434,38 @@ func buildChatHistory(stack []*models.Status) []Message {
 				statusText,
 			},
 		}
-		if status.Account.Acct == botAcct {
-			msg.Role = "assistant"
-		}
-		for _, attachment := range status.MediaAttachments {
-			if isValidImageAttachment(attachment) {
-				// send req to attachment.URL, get image binary and convert to base64
-				img := "data:image/jpeg;base64," + getBase64Image(attachment.URL)
-				imgContent := ChatContent{
-					Type: "image_url",
-					ImageURL: &ImageContent{
-						URL: img,
-					},
-				}
-				msg.ChatContent = append(msg.ChatContent, imgContent)
+		if b.isBotAccount(status.Account.Acct) {
+			author, text := b.personas.authorOf(t)
+			msg.ChatContent[0].Text = text
+			if author == persona {
+				msg.Role = "assistant"
 			} else {
-				msg.ChatContent[0].Text += fmt.Sprintf("\n【系统提示】媒体附件 %s 被跳过，因为数量可能超出限制或格式不受支持", filepath.Base(attachment.URL))
+				name := b.config.BotAccountName
+				if author != nil {
+					name = author.Name
+				}
+				msg.ChatContent[0].Text = fmt.Sprintf("[%s]: %s", name, text)
+			}
+		} else {
+			msg.authors = []string{b.fullAcct(status.Account.Acct)}
+			if b.config.PromptHardening {
+				msg.ChatContent[0].Text = bracketUntrusted(status.Account.Acct, t)
 			}
 		}
+		if quoted != nil && quoted.Account != nil {
+			msg.authors = append(msg.authors, b.fullAcct(quoted.Account.Acct))
+		}
+		msg.ChatContent = append(msg.ChatContent, images...)
+		if msg.ChatContent[0].Text == "" {
+			// Image-only post addressed to the bot: send just the images.
+			msg.ChatContent = msg.ChatContent[1:]
+		}
 		chatHistory = append(chatHistory, msg)
 	}
 
 	return chatHistory
 }
 
-func isValidImageAttachment(attachment *models.Attachment) bool {
-	validExtensions := []string{".jpg", ".jpeg", ".png"}
-	ext := strings.ToLower(filepath.Ext(attachment.URL))
-	for _, validExt := range validExtensions {
-		if ext == validExt {
-			return true
-		}
-	}
-	return false
-}
-
-func getBase64Image(url string) string {
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Printf("Failed to fetch image: %v", err)
-		return ""
-	}
-	defer resp.Body.Close()
-
-	imgBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Failed to read image: %v", err)
-		return ""
-	}
-
-	return base64.StdEncoding.EncodeToString(imgBytes)
-}
-
 func printChatHistory(chatHistory []Message) {
 	log.Println("Processing Chat History:")
 	for _, msg := range chatHistory {
@@ -228,114 +474,231 @@ func printChatHistory(chatHistory []Message) {
 	log.Println("")
 }
 
-func callGPT(chatHistory []Message) string {
-	url := fmt.Sprintf("%s/chat/completions", config.OpenAIAPIURL)
-	payload, _ := json.Marshal(map[string]interface{}{
-		"model":    config.OpenAIModel,
-		"messages": chatHistory,
-	})
+// Completion is a model reply with the metadata the provider reported about it.
+type Completion struct {
+	Content   string
+	ToolCalls []ToolCall
+	Usage     *TokenUsage
+	ResponseMetadata
+}
+
+type ResponseMetadata struct {
+	Model             string                 `json:"model,omitempty"`
+	SystemFingerprint string                 `json:"system_fingerprint,omitempty"`
+	FinishReason      string                 `json:"finish_reason,omitempty"`
+	Refusal           string                 `json:"refusal,omitempty"`
+	SafetyAnnotations map[string]interface{} `json:"safety_annotations,omitempty"`
+}
 
-	req, _ := http.NewRequest("POST", url, strings.NewReader(string(payload)))
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+config.OpenAIAPIKey)
+// safetyAnnotationKeys are provider-specific fields describing content filtering,
+// looked up on both the response and its first choice.
+var safetyAnnotationKeys = []string{"prompt_filter_results", "content_filter_results", "content_filter_result", "safety_ratings"}
 
-	res, err := openAI.Do(req)
+// callGPT always returns a completion; on failure its content is the error reply in lang.
+func (b *Bot) callGPT(ctx context.Context, chatHistory []Message, model string, params GenerationParams, lang string) *Completion {
+	completion, err := b.routeVision(chatHistory, model, b.withFallback(func(chatHistory []Message, model string) (*Completion, error) {
+		return b.chatCompletion(ctx, chatHistory, model, params)
+	}))
 	if err != nil {
 		log.Printf("Failed to call GPT service: %v", err)
-		return "ERROR: 与GPT服务通信失败，若问题持续，请联系管理员"
+		completion.Content = b.catalog.message(lang, "error.gpt")
+	}
+	return completion
+}
+
+// chatCompletion returns a non-nil completion even on error, carrying whatever
+// usage and metadata the response included.
+func (b *Bot) chatCompletion(ctx context.Context, chatHistory []Message, model string, params GenerationParams) (*Completion, error) {
+	if stub, ok := b.stubCompletion(model); ok {
+		return stub, nil
+	}
+	completion := &Completion{}
+	res, err := b.postChatRequest(ctx, b.chatRequest(chatHistory, model, params))
+	if err != nil {
+		return completion, err
 	}
 	defer res.Body.Close()
 
 	body, _ := io.ReadAll(res.Body)
 	var result map[string]interface{}
 	json.Unmarshal(body, &result)
+	completion.Usage = parseTokenUsage(result["usage"])
+	completion.Model, _ = result["model"].(string)
+	completion.SystemFingerprint, _ = result["system_fingerprint"].(string)
+	collectSafetyAnnotations(completion, result)
 
 	choices, ok := result["choices"].([]interface{})
 	if !ok || len(choices) == 0 {
-		log.Println("Invalid response format from GPT service")
-		return "ERROR: 与GPT服务通信失败，若问题持续，请联系管理员"
+		return completion, errors.New("invalid response format from GPT service")
 	}
 
-	message, ok := choices[0].(map[string]interface{})["message"].(map[string]interface{})
+	choice, _ := choices[0].(map[string]interface{})
+	completion.FinishReason, _ = choice["finish_reason"].(string)
+	collectSafetyAnnotations(completion, choice)
+
+	message, ok := choice["message"].(map[string]interface{})
 	if !ok {
-		log.Println("Invalid message format in GPT response")
-		return "ERROR: 与GPT服务通信失败，若问题持续，请联系管理员"
+		return completion, errors.New("invalid message format in GPT response")
 	}
+	completion.Refusal, _ = message["refusal"].(string)
 
+	completion.ToolCalls = parseToolCalls(message["tool_calls"])
 	content, ok := message["content"].(string)
-	if !ok {
-		log.Println("Invalid content format in GPT message")
-		return "ERROR: 与GPT服务通信失败，若问题持续，请联系管理员"
+	if !ok && (message["content"] != nil || len(completion.ToolCalls) == 0) {
+		return completion, errors.New("invalid content format in GPT message")
 	}
+	// Reasoning returned in its own field (reasoning_content) is ignored; inline reasoning is removed.
+	completion.Content = stripReasoning(content)
 
-	return content
+	return completion, nil
 }
 
-func replyToStatus(status *models.Status, response string) {
-	mentionAcct := fmt.Sprintf("@%s", status.Account.Acct)
-	fullResponse := fmt.Sprintf("%s %s", mentionAcct, response)
-	remaining := ""
-
-	if len(fullResponse) > config.MaxChar {
-		remaining = fullResponse[config.MaxChar:]
-		fullResponse = fullResponse[:config.MaxChar]
+// chatRequest builds the chat completion request body for model.
+func (b *Bot) chatRequest(chatHistory []Message, model string, params GenerationParams) map[string]interface{} {
+	request := map[string]interface{}{
+		"model":    model,
+		"messages": chatHistory,
 	}
-
-	params := statuses.NewStatusCreateParams().
-		WithStatus(ptr(fullResponse)).
-		WithInReplyToID(ptr(status.ID)).
-		WithContentType(ptr("text/markdown")).
-		WithLanguage(ptr(status.Language)).
-		WithVisibility(ptr(status.Visibility)).
-		WithLocalOnly(ptr(status.LocalOnly)).
-		WithSensitive(ptr(status.Sensitive))
-
-	if status.InteractionPolicy != nil {
-		if len(status.InteractionPolicy.CanFavourite.Always) > 0 {
-			params.SetInteractionPolicyCanFavouriteAlways0(ptr(string(status.InteractionPolicy.CanFavourite.Always[0])))
-		}
-		if len(status.InteractionPolicy.CanFavourite.WithApproval) > 0 {
-			params.SetInteractionPolicyCanFavouriteWithApproval0(ptr(string(status.InteractionPolicy.CanFavourite.WithApproval[0])))
+	reasoning := b.isReasoningModel(model)
+	if reasoning {
+		request["messages"] = reasoningMessages(chatHistory)
+		// Reasoning counts towards the completion tokens, so it gets its own
+		// cap, which raises a smaller explicit limit but does not lower one.
+		if b.config.ReasoningMaxTokens > 0 {
+			params.MaxTokens = max(params.MaxTokens, b.config.ReasoningMaxTokens)
 		}
-		if len(status.InteractionPolicy.CanReblog.Always) > 0 {
-			params.SetInteractionPolicyCanReblogAlways0(ptr(string(status.InteractionPolicy.CanReblog.Always[0])))
+		if b.config.ReasoningEffort != "" {
+			request["reasoning_effort"] = b.config.ReasoningEffort
 		}
-		if len(status.InteractionPolicy.CanReblog.WithApproval) > 0 {
-			params.SetInteractionPolicyCanReblogWithApproval0(ptr(string(status.InteractionPolicy.CanReblog.WithApproval[0])))
-		}
-		if len(status.InteractionPolicy.CanReply.Always) > 0 {
-			params.SetInteractionPolicyCanReplyAlways0(ptr(string(status.InteractionPolicy.CanReply.Always[0])))
+	}
+	params.apply(request, reasoning)
+	return request
+}
+
+func (b *Bot) postChatRequest(ctx context.Context, request map[string]interface{}) (*http.Response, error) {
+	model, _ := request["model"].(string)
+	request["model"], _ = splitModel(model)
+	payload, _ := json.Marshal(request)
+
+	req, err := b.newLLMRequest(ctx, b.llmURL("chat/completions", model), model, payload)
+	if err != nil {
+		return nil, err
+	}
+	return b.openAI.Do(req)
+}
+
+// parseToolCalls reads the function calls of a response message.
+func parseToolCalls(v interface{}) []ToolCall {
+	list, _ := v.([]interface{})
+	var calls []ToolCall
+	for _, item := range list {
+		call, _ := item.(map[string]interface{})
+		function, _ := call["function"].(map[string]interface{})
+		name, _ := function["name"].(string)
+		arguments, _ := function["arguments"].(string)
+		if name != "" {
+			calls = append(calls, ToolCall{Name: name, Arguments: arguments})
 		}
-		if len(status.InteractionPolicy.CanReply.WithApproval) > 0 {
-			params.SetInteractionPolicyCanReplyWithApproval0(ptr(string(status.InteractionPolicy.CanReply.WithApproval[0])))
+	}
+	return calls
+}
+
+func collectSafetyAnnotations(completion *Completion, fields map[string]interface{}) {
+	for _, key := range safetyAnnotationKeys {
+		if v, ok := fields[key]; ok && v != nil {
+			if completion.SafetyAnnotations == nil {
+				completion.SafetyAnnotations = map[string]interface{}{}
+			}
+			completion.SafetyAnnotations[key] = v
 		}
 	}
+}
 
-	if status.Visibility == "public" {
-		params.SetVisibility(ptr("unlisted"))
+func parseTokenUsage(v interface{}) *TokenUsage {
+	u, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
 	}
-	if status.Visibility == "private" || status.Visibility == "mutuals_only" {
-		params.SetVisibility(ptr("direct"))
+	count := func(key string) int {
+		n, _ := u[key].(float64)
+		return int(n)
 	}
-	if status.SpoilerText != "" {
-		params.SpoilerText = ptr("re: " + status.SpoilerText)
+	return &TokenUsage{
+		PromptTokens:     count("prompt_tokens"),
+		CompletionTokens: count("completion_tokens"),
+		TotalTokens:      count("total_tokens"),
 	}
+}
 
-	reply, err := gts.Client.Statuses.StatusCreate(
-		params,
-		gts.Auth,
-		func(op *runtime.ClientOperation) {
-			op.ConsumesMediaTypes = []string{"multipart/form-data"}
-		},
-	)
-	if err != nil {
-		log.Printf("Failed to create reply status: %v", err)
-		return
+func (b *Bot) replyToStatus(ctx context.Context, status *models.Status, response string) {
+	b.postChain(ctx, status, b.replyParams(status), status.ID, b.splitReply(response, b.replyLimit(status)))
+}
+
+// replyLimit is the room left for text in a reply to status after the mention.
+func (b *Bot) replyLimit(status *models.Status) int {
+	return b.config.MaxChar - statusLength(replyMention(status))
+}
+
+func replyMention(status *models.Status) string {
+	return fmt.Sprintf("@%s ", status.Account.Acct)
+}
+
+// postChain posts parts as replies to status with the settings of post, each
+// replying to the previous one, starting below inReplyTo. It returns the last
+// status posted, or nil if none could be.
+func (b *Bot) postChain(ctx context.Context, status *models.Status, post *StatusPost, inReplyTo string, parts []string) *models.Status {
+	last := b.postThread(ctx, post, replyMention(status), inReplyTo, parts)
+	if last != nil {
+		b.replies.replied(status.ID, last.ID)
 	}
+	return last
+}
 
-	if remaining != "" {
-		replyToStatus(reply.Payload, remaining)
+// postThread posts parts with the settings of post, each prefixed with
+// prefix and replying to the previous one. The first part replies to
+// inReplyTo, or starts a new thread if it is empty. Parts that cannot be
+// posted are queued in the outbox.
+func (b *Bot) postThread(ctx context.Context, post *StatusPost, prefix, inReplyTo string, parts []string) *models.Status {
+	var last *models.Status
+	for i, part := range parts {
+		post.Text = prefix + part
+		post.InReplyToID = inReplyTo
+		reply, err := b.backend.PostStatus(ctx, post)
+		if err != nil {
+			log.Printf("Failed to create status: %v", err)
+			b.queue(post, prefix, inReplyTo, parts[i:])
+			break
+		}
+		last = reply
+		inReplyTo = reply.ID
+	}
+	return last
+}
+
+// replyParams returns the settings for a reply to status: the same language,
+// content type, interaction policy and content warning, and no wider a
+// visibility. With CW_POLICY=always, replies get a content warning even if
+// status has none.
+func (b *Bot) replyParams(status *models.Status) *StatusPost {
+	post := &StatusPost{
+		ContentType:       "text/markdown",
+		Language:          status.Language,
+		Visibility:        status.Visibility,
+		LocalOnly:         status.LocalOnly,
+		Sensitive:         status.Sensitive,
+		InteractionPolicy: status.InteractionPolicy,
+	}
+	if status.Visibility == "public" {
+		post.Visibility = "unlisted"
+	}
+	if status.Visibility == "private" || status.Visibility == "mutuals_only" {
+		post.Visibility = "direct"
+	}
+	if status.SpoilerText != "" {
+		post.SpoilerText = fmt.Sprintf(b.catalog.message(status.Language, "cw.reply"), status.SpoilerText)
 	}
+	post.SpoilerText = b.autoContentWarning(post.SpoilerText, status.Language)
+	return post
 }
 
 func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+var leadingMentionsRe = regexp.MustCompile(`^(\s*@[\w.-]+(@[\w.-]+)?)+\s*`)
+
+// displayNames maps the accounts of a thread's authors to their display names.
+func (b *Bot) displayNames(stack []*models.Status) map[string]string {
+	names := map[string]string{}
+	for _, status := range stack {
+		if status.Account != nil && status.Account.DisplayName != "" {
+			names[b.fullAcct(status.Account.Acct)] = status.Account.DisplayName
+		}
+	}
+	return names
+}
+
+// normalizeMentions removes the addressing mentions at the start of a post and
+// the bot's own mention, and replaces other mentions with display names, so
+// the model neither sees nor echoes back handles that would ping people.
+func (b *Bot) normalizeMentions(status *models.Status, text string, names map[string]string) string {
+	text = leadingMentionsRe.ReplaceAllString(text, "")
+
+	for _, mention := range status.Mentions {
+		if b.isBotAccount(mention.Acct) {
+			// Also drop one following space so no double space is left behind.
+			text = regexp.MustCompile(mentionPattern(mention).String()+`[ \t]?`).ReplaceAllString(text, "${1}")
+			continue
+		}
+		name := names[b.fullAcct(mention.Acct)]
+		if name == "" {
+			name = mention.Username
+		}
+		text = mentionPattern(mention).ReplaceAllString(text, "${1}"+strings.ReplaceAll(name, "$", "$$"))
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// mentionPattern matches the forms a mention takes in status text:
+// @user, @user@domain, or @user@host when the profile host differs from the domain.
+func mentionPattern(mention *models.Mention) *regexp.Regexp {
+	domains := []string{}
+	if _, domain, ok := strings.Cut(mention.Acct, "@"); ok {
+		domains = append(domains, regexp.QuoteMeta(domain))
+	}
+	if u, err := url.Parse(mention.URL); err == nil && u.Host != "" {
+		domains = append(domains, regexp.QuoteMeta(u.Host))
+	}
+
+	pattern := `(^|[^\w@])@` + regexp.QuoteMeta(mention.Username)
+	if len(domains) > 0 {
+		pattern += `(?:@(?:` + strings.Join(domains, "|") + `))?`
+	}
+	return regexp.MustCompile(`(?i)` + pattern + `\b`)
+}
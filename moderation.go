@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// moderate checks inputs against the moderation endpoint and returns the
+// flagged categories, if any input was flagged.
+func (b *Bot) moderate(ctx context.Context, inputs []string) (bool, []string, error) {
+	url := b.config.ModerationURL
+	if url == "" {
+		url = b.llmURL("moderations", b.config.ModerationModel)
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"model": b.config.ModerationModel,
+		"input": inputs,
+	})
+
+	req, err := b.newLLMRequest(ctx, url, b.config.ModerationModel, payload)
+	if err != nil {
+		return false, nil, err
+	}
+	res, err := b.openAI.Do(req)
+	if err != nil {
+		return false, nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return false, nil, fmt.Errorf("moderation service returned non-200 status code: %d", res.StatusCode)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	var result moderationResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return false, nil, err
+	}
+
+	flagged := false
+	var categories []string
+	for _, r := range result.Results {
+		if !r.Flagged {
+			continue
+		}
+		flagged = true
+		for category, hit := range r.Categories {
+			if hit {
+				categories = append(categories, category)
+			}
+		}
+	}
+	return flagged, categories, nil
+}
+
+// moderateInput reports whether the user-authored messages of a chat history
+// should be refused. Moderation errors let the request through.
+func (b *Bot) moderateInput(ctx context.Context, acct string, chatHistory []Message) bool {
+	if !b.config.ModerateInput {
+		return false
+	}
+
+	var inputs []string
+	for _, msg := range chatHistory {
+		if msg.Role != "user" {
+			continue
+		}
+		for _, c := range msg.ChatContent {
+			if c.Type == "text" && c.Text != "" {
+				inputs = append(inputs, c.Text)
+			}
+		}
+	}
+	if len(inputs) == 0 {
+		return false
+	}
+
+	flagged, categories, err := b.moderate(ctx, inputs)
+	if err != nil {
+		log.Printf("Failed to moderate input: %v", err)
+		return false
+	}
+	if flagged {
+		log.Printf("Input from %s flagged by moderation: %s", acct, strings.Join(categories, ", "))
+	}
+	return flagged
+}
+
+// moderationMessage is the reply to flagged content: MODERATION_MESSAGE, or
+// the language pack's message in lang.
+func (b *Bot) moderationMessage(lang string) string {
+	if b.config.ModerationMessage != "" {
+		return b.config.ModerationMessage
+	}
+	return b.catalog.message(lang, "moderation.declined")
+}
+
+// moderateOutput reports whether a generated reply must not be posted.
+// Moderation errors withhold the reply.
+func (b *Bot) moderateOutput(ctx context.Context, acct string, response string) bool {
+	if !b.config.ModerateOutput {
+		return false
+	}
+
+	flagged, categories, err := b.moderate(ctx, []string{response})
+	if err != nil {
+		log.Printf("Failed to moderate output: %v", err)
+		return true
+	}
+	if flagged {
+		log.Printf("Reply to %s flagged by moderation: %s", acct, strings.Join(categories, ", "))
+	}
+	return flagged
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	outboxFile = "outbox.json"
+	// outboxMaxBackoff caps the growing pause between attempts.
+	outboxMaxBackoff = time.Hour
+)
+
+// outboxEntry is the part of a thread that could not be posted: the
+// remaining parts, with the settings and prefix of the thread and the status
+// the next part replies to.
+type outboxEntry struct {
+	ID          string     `json:"id"`
+	Post        StatusPost `json:"post"`
+	Prefix      string     `json:"prefix"`
+	InReplyTo   string     `json:"in_reply_to"`
+	Parts       []string   `json:"parts"`
+	Attempts    int        `json:"attempts"`
+	NextAttempt time.Time  `json:"next_attempt"`
+}
+
+// outbox keeps the posts that failed, so generated replies are not lost when
+// the server is briefly unavailable. It is saved after every change and
+// picked up again after a restart.
+type outbox struct {
+	mu      sync.Mutex
+	dir     dataDir
+	Entries []*outboxEntry `json:"entries"`
+}
+
+func newOutbox(dir dataDir) *outbox {
+	o := &outbox{dir: dir}
+	if err := dir.load(outboxFile, o); err != nil {
+		log.Printf("Failed to load outbox: %v", err)
+	}
+	if len(o.Entries) > 0 {
+		log.Printf("Outbox has %d queued threads", len(o.Entries))
+	}
+	return o
+}
+
+func (o *outbox) reset() {
+	o.Entries = nil
+}
+
+func (o *outbox) add(e *outboxEntry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer o.dir.sync(outboxFile, o, o.reset)()
+
+	o.Entries = append(o.Entries, e)
+	o.save()
+}
+
+// list returns copies of the queued entries, oldest first.
+func (o *outbox) list() []outboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer o.dir.sync(outboxFile, o, o.reset)()
+
+	entries := make([]outboxEntry, len(o.Entries))
+	for i, e := range o.Entries {
+		entries[i] = *e
+	}
+	return entries
+}
+
+// retryNow makes the entry with id due at the next poll.
+func (o *outbox) retryNow(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer o.dir.sync(outboxFile, o, o.reset)()
+
+	for _, e := range o.Entries {
+		if e.ID == id {
+			e.NextAttempt = time.Time{}
+			o.save()
+			return true
+		}
+	}
+	return false
+}
+
+// discard drops the entry with id.
+func (o *outbox) discard(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer o.dir.sync(outboxFile, o, o.reset)()
+
+	n := len(o.Entries)
+	o.Entries = slices.DeleteFunc(o.Entries, func(e *outboxEntry) bool { return e.ID == id })
+	if len(o.Entries) == n {
+		return false
+	}
+	o.save()
+	return true
+}
+
+// forget drops the entries for which addressed is true and returns how many
+// there were.
+func (o *outbox) forget(addressed func(e *outboxEntry) bool) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer o.dir.sync(outboxFile, o, o.reset)()
+
+	n := len(o.Entries)
+	o.Entries = slices.DeleteFunc(o.Entries, addressed)
+	if len(o.Entries) < n {
+		o.save()
+	}
+	return n - len(o.Entries)
+}
+
+// due returns copies of the entries whose next attempt is before now.
+func (o *outbox) due(now time.Time) []*outboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer o.dir.sync(outboxFile, o, o.reset)()
+
+	var due []*outboxEntry
+	for _, e := range o.Entries {
+		if !e.NextAttempt.After(now) {
+			c := *e
+			due = append(due, &c)
+		}
+	}
+	return due
+}
+
+// sent records that the first part of e was posted as replyID.
+func (o *outbox) sent(e *outboxEntry, replyID string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer o.dir.sync(outboxFile, o, o.reset)()
+
+	e.Parts = e.Parts[1:]
+	e.InReplyTo = replyID
+	o.update(e, len(e.Parts) == 0)
+}
+
+// failed schedules the next attempt for e, doubling the pause each time, or
+// gives it up after maxAttempts.
+func (o *outbox) failed(e *outboxEntry, interval time.Duration, maxAttempts int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer o.dir.sync(outboxFile, o, o.reset)()
+
+	e.Attempts++
+	if e.Attempts >= maxAttempts {
+		log.Printf("Giving up on %d queued posts after %d attempts", len(e.Parts), e.Attempts)
+		o.update(e, true)
+		return
+	}
+	wait := interval << (e.Attempts - 1)
+	if wait <= 0 || wait > outboxMaxBackoff {
+		wait = outboxMaxBackoff
+	}
+	e.NextAttempt = time.Now().Add(wait)
+	o.update(e, false)
+}
+
+// update puts e, a copy returned by due, in place of its entry, or removes
+// the entry if done. Entries discarded meanwhile stay discarded.
+func (o *outbox) update(e *outboxEntry, done bool) {
+	i := slices.IndexFunc(o.Entries, func(x *outboxEntry) bool { return x.ID == e.ID })
+	if i < 0 {
+		return
+	}
+	if done {
+		o.Entries = slices.Delete(o.Entries, i, i+1)
+	} else {
+		c := *e
+		o.Entries[i] = &c
+	}
+	o.save()
+}
+
+func (o *outbox) save() {
+	if err := o.dir.save(outboxFile, o); err != nil {
+		log.Printf("Failed to save outbox: %v", err)
+	}
+}
+
+// queue keeps parts that could not be posted in the outbox, to be posted
+// with the settings of post, each prefixed with prefix, below inReplyTo.
+func (b *Bot) queue(post *StatusPost, prefix, inReplyTo string, parts []string) {
+	if b.outbox == nil || b.config.OutboxMaxAttempts <= 0 {
+		return
+	}
+	b.outbox.add(&outboxEntry{
+		ID:          strconv.FormatInt(time.Now().UnixNano(), 36),
+		Post:        *post,
+		Prefix:      prefix,
+		InReplyTo:   inReplyTo,
+		Parts:       parts,
+		NextAttempt: time.Now().Add(b.config.OutboxRetryInterval),
+	})
+	log.Printf("Queued %d posts in the outbox", len(parts))
+}
+
+// retryOutbox posts the queued threads that are due, each resuming where it stopped.
+func (b *Bot) retryOutbox(ctx context.Context) {
+	for _, e := range b.outbox.due(time.Now()) {
+		post := e.Post
+		for len(e.Parts) > 0 {
+			post.Text = e.Prefix + e.Parts[0]
+			post.InReplyToID = e.InReplyTo
+			reply, err := b.backend.PostStatus(ctx, &post)
+			if err != nil {
+				log.Printf("Failed to post from the outbox (attempt %d): %v", e.Attempts+1, err)
+				b.outbox.failed(e, b.config.OutboxRetryInterval, b.config.OutboxMaxAttempts)
+				break
+			}
+			b.outbox.sent(e, reply.ID)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const (
+	declinedThreadsFile = "declined_threads.json"
+	declinedRetention   = 30 * 24 * time.Hour
+	threadLimitKey      = "limit:"
+)
+
+// declinedThreads remembers the threads the bot has declined to join, keyed
+// by the ID of the oldest known status, or left when they grew too long,
+// keyed by that ID prefixed with threadLimitKey, so each thread is only told once.
+type declinedThreads struct {
+	mu      sync.Mutex
+	dir     dataDir
+	Threads map[string]time.Time `json:"threads"`
+}
+
+func newDeclinedThreads(dir dataDir) *declinedThreads {
+	d := &declinedThreads{dir: dir}
+	if err := dir.load(declinedThreadsFile, d); err != nil {
+		log.Printf("Failed to load declined threads: %v", err)
+	}
+	if d.Threads == nil {
+		d.Threads = map[string]time.Time{}
+	}
+	return d
+}
+
+func (d *declinedThreads) reset() {
+	d.Threads = map[string]time.Time{}
+}
+
+// add records the thread and reports whether it was not declined before.
+func (d *declinedThreads) add(root string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.dir.sync(declinedThreadsFile, d, d.reset)()
+
+	if _, ok := d.Threads[root]; ok {
+		return false
+	}
+	now := time.Now()
+	d.Threads[root] = now
+	for id, t := range d.Threads {
+		if now.Sub(t) > declinedRetention {
+			delete(d.Threads, id)
+		}
+	}
+
+	if err := d.dir.save(declinedThreadsFile, d); err != nil {
+		log.Printf("Failed to save declined threads: %v", err)
+	}
+	return true
+}
+
+// participants counts the distinct accounts, other than the bot, that wrote
+// or are mentioned in the thread.
+func (b *Bot) participants(thread []*models.Status) int {
+	accts := map[string]bool{}
+	for _, status := range thread {
+		if status.Account != nil && !b.isBotAccount(status.Account.Acct) {
+			accts[b.fullAcct(status.Account.Acct)] = true
+		}
+		for _, mention := range status.Mentions {
+			if !b.isBotAccount(mention.Acct) {
+				accts[b.fullAcct(mention.Acct)] = true
+			}
+		}
+	}
+	return len(accts)
+}
+
+// declineCrowdedThread reports whether the thread has more participants than
+// MAX_PARTICIPANTS allows. The first time a thread is declined the bot says
+// so; later mentions in the same thread are ignored silently.
+func (b *Bot) declineCrowdedThread(ctx context.Context, status *models.Status, thread []*models.Status) bool {
+	if b.config.MaxParticipants <= 0 {
+		return false
+	}
+	count := b.participants(thread)
+	if count <= b.config.MaxParticipants {
+		return false
+	}
+
+	root := thread[len(thread)-1].ID
+	log.Printf("Declining thread %s with %d participants", root, count)
+	if b.declined.add(root) {
+		b.replyToStatus(ctx, status, b.catalog.message(status.Language, "participants.decline"))
+	}
+	return true
+}
+
+// endLongThread reports whether the bot has already replied MAX_THREAD_REPLIES
+// times in the thread. The first time it declines in a thread it says it is
+// leaving, unless THREAD_LIMIT_NOTICE is off; later mentions are ignored
+// silently.
+func (b *Bot) endLongThread(ctx context.Context, status *models.Status, thread []*models.Status) bool {
+	if b.config.MaxThreadReplies <= 0 {
+		return false
+	}
+	replies := b.threadReplies(thread)
+	if replies < b.config.MaxThreadReplies {
+		return false
+	}
+
+	log.Printf("Not replying to %s: already replied %d times in its thread", status.ID, replies)
+	if b.config.ThreadLimitNotice && b.declined.add(threadLimitKey+thread[len(thread)-1].ID) {
+		b.replyToStatus(ctx, status, b.catalog.message(status.Language, "thread.limit"))
+	}
+	return true
+}
+
+// threadReplies counts the bot's replies in the thread. The parts of a reply
+// split over several posts, each answering the one before, count once.
+func (b *Bot) threadReplies(thread []*models.Status) int {
+	ours := map[string]bool{}
+	for _, s := range thread {
+		if s.Account != nil && b.isBotAccount(s.Account.Acct) {
+			ours[s.ID] = true
+		}
+	}
+	replies := 0
+	for _, s := range thread {
+		if ours[s.ID] && !ours[s.InReplyToID] {
+			replies++
+		}
+	}
+	return replies
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const personaSelectionsFile = "persona_selections.json"
+
+// Persona is a character the bot can answer as. Replies are marked with the
+// persona's prefix and/or signature so later turns can be attributed to it.
+type Persona struct {
+	Name         string `json:"name"`
+	Prefix       string `json:"prefix,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	Model        string `json:"model,omitempty"`
+}
+
+// personaStore holds the configured personas, which are read-only after
+// loading, and each account's persona selection.
+type personaStore struct {
+	personas []*Persona
+
+	mu         sync.Mutex
+	dir        dataDir
+	selections map[string]string // account -> persona name
+}
+
+func newPersonaStore(file string, dir dataDir) *personaStore {
+	s := &personaStore{dir: dir, selections: map[string]string{}}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Printf("Failed to read personas: %v", err)
+		} else if err := json.Unmarshal(data, &s.personas); err != nil {
+			log.Printf("Failed to parse personas: %v", err)
+		}
+	}
+	for _, p := range s.personas {
+		if err := checkPrompt(p.SystemPrompt); err != nil {
+			log.Printf("Persona %s has an invalid system prompt: %v", p.Name, err)
+		}
+	}
+	if err := dir.load(personaSelectionsFile, &s.selections); err != nil {
+		log.Printf("Failed to load persona selections: %v", err)
+	}
+	return s
+}
+
+func (s *personaStore) reset() {
+	s.selections = map[string]string{}
+}
+
+func (s *personaStore) find(name string) *Persona {
+	for _, p := range s.personas {
+		if strings.EqualFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// active returns the persona selected by acct, or nil for the default persona.
+func (s *personaStore) active(acct string) *Persona {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.dir.sync(personaSelectionsFile, &s.selections, s.reset)()
+	return s.find(s.selections[acct])
+}
+
+func (s *personaStore) selectFor(acct string, p *Persona) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.dir.sync(personaSelectionsFile, &s.selections, s.reset)()
+
+	if p == nil {
+		delete(s.selections, acct)
+	} else {
+		s.selections[acct] = p.Name
+	}
+	if err := s.dir.save(personaSelectionsFile, s.selections); err != nil {
+		log.Printf("Failed to save persona selections: %v", err)
+	}
+}
+
+// authorOf identifies which persona wrote a bot status and returns the text
+// with its prefix and signature removed. A nil persona means the default one.
+func (s *personaStore) authorOf(text string) (*Persona, string) {
+	for _, p := range s.personas {
+		hasPrefix := p.Prefix != "" && strings.Contains(text, p.Prefix)
+		hasSignature := p.Signature != "" && strings.Contains(text, p.Signature)
+		if !hasPrefix && !hasSignature {
+			continue
+		}
+		if hasPrefix {
+			text = strings.Replace(text, p.Prefix, "", 1)
+		}
+		if hasSignature {
+			text = strings.Replace(text, p.Signature, "", 1)
+		}
+		return p, strings.TrimSpace(text)
+	}
+	return nil, text
+}
+
+func (b *Bot) personaSystemPrompt(p *Persona) string {
+	if p != nil && p.SystemPrompt != "" {
+		return p.SystemPrompt
+	}
+	return b.config.SystemPrompt
+}
+
+func (b *Bot) personaModel(p *Persona) string {
+	if p != nil && p.Model != "" {
+		return p.Model
+	}
+	return b.config.OpenAIModel
+}
+
+// decorateReply marks a reply with the persona's prefix and signature.
+func decorateReply(p *Persona, response string) string {
+	if p == nil {
+		return response
+	}
+	if p.Prefix != "" {
+		response = p.Prefix + " " + response
+	}
+	if p.Signature != "" {
+		response += "\n\n" + p.Signature
+	}
+	return response
+}
+
+func personaCommand(ctx context.Context, b *Bot, status *models.Status, args []string) string {
+	acct := b.fullAcct(status.Account.Acct)
+	lang := status.Language
+	if len(b.personas.personas) == 0 {
+		return b.catalog.message(lang, "persona.none")
+	}
+
+	if len(args) == 0 {
+		current := "default"
+		if p := b.personas.active(acct); p != nil {
+			current = p.Name
+		}
+		names := []string{"default"}
+		for _, p := range b.personas.personas {
+			names = append(names, p.Name)
+		}
+		return fmt.Sprintf(b.catalog.message(lang, "persona.list"), current, strings.Join(names, b.catalog.message(lang, "list.separator")))
+	}
+
+	if strings.EqualFold(args[0], "default") {
+		b.personas.selectFor(acct, nil)
+		return b.catalog.message(lang, "persona.default")
+	}
+	p := b.personas.find(args[0])
+	if p == nil {
+		return fmt.Sprintf(b.catalog.message(lang, "persona.unknown"), args[0])
+	}
+	b.personas.selectFor(acct, p)
+	return fmt.Sprintf(b.catalog.message(lang, "persona.selected"), p.Name)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	pollCursorFile = "poll_cursor.json"
+	// deltaDrainInterval is the pause between pages while a backlog is being drained.
+	deltaDrainInterval = time.Second
+)
+
+// pollCursor remembers the newest notification handled in delta mode.
+type pollCursor struct {
+	mu  sync.Mutex
+	dir dataDir
+	ID  string `json:"id"`
+}
+
+func newPollCursor(dir dataDir) *pollCursor {
+	c := &pollCursor{dir: dir}
+	if err := dir.load(pollCursorFile, c); err != nil {
+		log.Printf("Failed to load poll cursor: %v", err)
+	}
+	return c
+}
+
+func (c *pollCursor) reset() {
+	c.ID = ""
+}
+
+func (c *pollCursor) get() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.dir.sync(pollCursorFile, c, c.reset)()
+	return c.ID
+}
+
+func (c *pollCursor) set(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.dir.sync(pollCursorFile, c, c.reset)()
+
+	c.ID = id
+	if err := c.dir.save(pollCursorFile, c); err != nil {
+		log.Printf("Failed to save poll cursor: %v", err)
+	}
+}
+
+// pollDelta fetches only the notifications newer than the cursor, a small
+// page at a time, and returns how long to wait before the next poll: short
+// while a backlog is drained, growing up to POLL_MAX_INTERVAL while idle.
+func (b *Bot) pollDelta(ctx context.Context, interval time.Duration) time.Duration {
+	limit := int64(b.config.PollLimit)
+	notifs, err := b.backend.Notifications(ctx, NotificationQuery{
+		Limit: limit,
+		MinID: b.cursor.get(),
+		Types: handledNotificationTypes,
+	})
+	b.lastPoll.set(len(notifs), err)
+	if err != nil {
+		log.Printf("Failed to fetch notifications: %v", err)
+		return b.idleInterval(interval)
+	}
+	if len(notifs) == 0 {
+		return b.idleInterval(interval)
+	}
+
+	// Pages are returned newest first; handle them in order so the cursor only moves forward.
+	for i := len(notifs) - 1; i >= 0; i-- {
+		b.handleNotification(ctx, notifs[i])
+		b.cursor.set(notifs[i].ID)
+	}
+
+	if int64(len(notifs)) >= limit {
+		return deltaDrainInterval
+	}
+	return b.config.PollInterval
+}
+
+func (b *Bot) idleInterval(interval time.Duration) time.Duration {
+	interval *= 2
+	if interval < b.config.PollInterval {
+		interval = b.config.PollInterval
+	}
+	if interval > b.config.PollMaxInterval {
+		interval = b.config.PollMaxInterval
+	}
+	return interval
+}
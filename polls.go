@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const (
+	createPollTool = "create_poll"
+	// Limits every common server accepts.
+	pollMaxOptions      = 4
+	pollMaxOptionLength = 50
+	pollMinExpiry       = 5 * 60
+	pollMaxExpiry       = 7 * 24 * 60 * 60
+	pollDefaultExpiry   = 24 * 60 * 60
+)
+
+// ToolCall is a function call requested by the model.
+type ToolCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// PollRequest is the argument of the create_poll tool.
+type PollRequest struct {
+	Question  string   `json:"question"`
+	Options   []string `json:"options"`
+	ExpiresIn int64    `json:"expires_in"`
+	Multiple  bool     `json:"multiple"`
+}
+
+var pollToolDefinition = map[string]interface{}{
+	"type": "function",
+	"function": map[string]interface{}{
+		"name":        createPollTool,
+		"description": "Post a poll as the reply. Only use this when the user asks for a poll.",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"question": map[string]interface{}{"type": "string", "description": "The poll question, in the user's language."},
+				"options": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": fmt.Sprintf("Between 2 and %d short answer options, at most %d characters each.", pollMaxOptions, pollMaxOptionLength),
+				},
+				"expires_in": map[string]interface{}{"type": "integer", "description": "How long the poll runs, in seconds."},
+				"multiple":   map[string]interface{}{"type": "boolean", "description": "Whether voters may pick more than one option."},
+			},
+			"required": []string{"question", "options"},
+		},
+	},
+}
+
+// pollText describes a poll and its current results for the model.
+func pollText(poll *models.Poll) string {
+	if poll == nil {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n[Poll")
+	if poll.Multiple {
+		sb.WriteString(", multiple choice")
+	}
+	fmt.Fprintf(&sb, ", %d votes", poll.VotesCount)
+	if poll.Expired {
+		sb.WriteString(", closed")
+	} else if poll.ExpiresAt != "" {
+		fmt.Fprintf(&sb, ", closes %s", poll.ExpiresAt)
+	}
+	sb.WriteString("]")
+	for _, option := range poll.Options {
+		fmt.Fprintf(&sb, "\n- %s: %d", option.Title, option.VotesCount)
+	}
+	return sb.String()
+}
+
+// requestedPoll returns the poll the model asked to create, if it called the
+// tool with usable arguments.
+func requestedPoll(calls []ToolCall) *PollRequest {
+	for _, call := range calls {
+		if call.Name != createPollTool {
+			continue
+		}
+		var poll PollRequest
+		if err := json.Unmarshal([]byte(call.Arguments), &poll); err != nil {
+			log.Printf("Ignoring invalid %s arguments %q: %v", createPollTool, call.Arguments, err)
+			continue
+		}
+		if poll.normalize() {
+			return &poll
+		}
+		log.Printf("Ignoring %s call with unusable arguments %q", createPollTool, call.Arguments)
+	}
+	return nil
+}
+
+// normalize fits the poll into server limits and reports whether it is usable.
+func (p *PollRequest) normalize() bool {
+	p.Question = strings.TrimSpace(p.Question)
+	var options []string
+	for _, option := range p.Options {
+		option = strings.TrimSpace(option)
+		if utf8.RuneCountInString(option) > pollMaxOptionLength {
+			option = string([]rune(option)[:pollMaxOptionLength-1]) + "…"
+		}
+		if option != "" && len(options) < pollMaxOptions {
+			options = append(options, option)
+		}
+	}
+	p.Options = options
+
+	switch {
+	case p.ExpiresIn <= 0:
+		p.ExpiresIn = pollDefaultExpiry
+	case p.ExpiresIn < pollMinExpiry:
+		p.ExpiresIn = pollMinExpiry
+	case p.ExpiresIn > pollMaxExpiry:
+		p.ExpiresIn = pollMaxExpiry
+	}
+	return p.Question != "" && len(p.Options) >= 2
+}
+
+// replyWithPoll posts text as a reply to status with the settings of post and the poll attached.
+func (b *Bot) replyWithPoll(ctx context.Context, status *models.Status, post *StatusPost, text string, poll *PollRequest) {
+	limit := b.replyLimit(status)
+	if statusLength(text) > limit {
+		text = strings.TrimSpace(text[:statusCut(text, limit-1)]) + "…"
+	}
+
+	post.Text = replyMention(status) + text
+	post.InReplyToID = status.ID
+	post.Poll = poll
+	reply, err := b.backend.PostStatus(ctx, post)
+	if err != nil {
+		log.Printf("Failed to create poll: %v", err)
+		b.queue(post, "", status.ID, []string{post.Text})
+		return
+	}
+	b.replies.replied(status.ID, reply.ID)
+}
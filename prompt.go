@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// maxPromptNameLength caps the requester's display name in the system prompt,
+// since it is chosen by the requester.
+const maxPromptNameLength = 64
+
+// PromptVars are the variables of system prompt templates, such as
+// "Today is {{.Date}}". User, UserAcct and Visibility are empty when no one
+// asked, as for scheduled and feed posts.
+type PromptVars struct {
+	Now        time.Time
+	Date       string
+	Time       string
+	Weekday    string
+	Timezone   string
+	Bot        string
+	Domain     string
+	Persona    string
+	User       string
+	UserAcct   string
+	Visibility string
+	Language   string
+}
+
+// promptVars returns the variables for a system prompt answering status as
+// persona. status may be nil.
+func (b *Bot) promptVars(status *models.Status, persona *Persona) PromptVars {
+	now := time.Now().In(b.config.ScheduleTimezone)
+	vars := PromptVars{
+		Now:      now,
+		Date:     now.Format("2006-01-02"),
+		Time:     now.Format("15:04"),
+		Weekday:  now.Weekday().String(),
+		Timezone: now.Format("MST"),
+		Bot:      "@" + b.fullAcct(b.config.BotAccountName),
+		Domain:   b.config.FediDomain,
+	}
+	if persona != nil {
+		vars.Persona = persona.Name
+	}
+	if status == nil {
+		return vars
+	}
+	vars.Visibility = status.Visibility
+	vars.Language = languageName(status.Language)
+	if status.Account != nil {
+		vars.UserAcct = "@" + b.fullAcct(status.Account.Acct)
+		vars.User = promptName(status.Account)
+	}
+	return vars
+}
+
+// promptName returns the display name of account, or its username if it has
+// none, on one line and shortened to maxPromptNameLength.
+func promptName(account *models.Account) string {
+	name := strings.Join(strings.Fields(account.DisplayName), " ")
+	if name == "" {
+		name = account.Username
+	}
+	if runes := []rune(name); len(runes) > maxPromptNameLength {
+		name = string(runes[:maxPromptNameLength])
+	}
+	return name
+}
+
+// renderPrompt fills in a system prompt template. Prompts without "{{" are
+// used as they are, and so are templates that fail, after logging why.
+func renderPrompt(prompt string, vars PromptVars) string {
+	if !strings.Contains(prompt, "{{") {
+		return prompt
+	}
+	var out strings.Builder
+	if err := executePrompt(&out, prompt, vars); err != nil {
+		log.Printf("Failed to render system prompt: %v", err)
+		return prompt
+	}
+	return out.String()
+}
+
+func executePrompt(out *strings.Builder, prompt string, vars PromptVars) error {
+	tmpl, err := template.New("system prompt").Option("missingkey=error").Parse(prompt)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(out, vars)
+}
+
+// checkPrompt reports whether a system prompt template parses and only uses
+// known variables.
+func checkPrompt(prompt string) error {
+	var out strings.Builder
+	return executePrompt(&out, prompt, PromptVars{})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// LLMProvider is an OpenAI-compatible API. Models are served by the main
+// provider (OPENAI_API_URL), or by a named one when written as
+// "model@name", which is configured with PROVIDER_<NAME>_URL, _KEY and
+// _TYPE.
+type LLMProvider struct {
+	URL  string
+	Key  string
+	Type string // "openai" or "azure"
+}
+
+// getEnvProviders collects the named providers from the environment.
+func getEnvProviders() map[string]LLMProvider {
+	providers := map[string]LLMProvider{}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		name, ok := strings.CutPrefix(key, "PROVIDER_")
+		if !ok {
+			continue
+		}
+		if name, ok = strings.CutSuffix(name, "_URL"); !ok {
+			continue
+		}
+		prefix := "PROVIDER_" + name + "_"
+		providers[strings.ToLower(name)] = LLMProvider{
+			URL:  strings.TrimSuffix(getEnv(prefix+"URL", ""), "/"),
+			Key:  getEnv(prefix+"KEY", ""),
+			Type: getEnv(prefix+"TYPE", "openai"),
+		}
+	}
+	return providers
+}
+
+// splitModel separates a model name from the provider it is served by, if any.
+func splitModel(model string) (name, provider string) {
+	name, provider, _ = strings.Cut(model, "@")
+	return name, strings.ToLower(provider)
+}
+
+// llmProvider returns the provider serving model.
+func (b *Bot) llmProvider(model string) LLMProvider {
+	main := LLMProvider{URL: b.config.OpenAIAPIURL, Key: b.config.OpenAIAPIKey, Type: b.config.OpenAIProvider}
+	_, name := splitModel(model)
+	if name == "" {
+		return main
+	}
+	p, ok := b.config.Providers[name]
+	if !ok {
+		log.Printf("Unknown provider %q for %s, using the main one", name, model)
+		return main
+	}
+	return p
+}
+
+// llmURL returns the URL of an OpenAI API endpoint, such as
+// "chat/completions", for model. Azure OpenAI addresses models by their
+// deployment name in the path and versions its API with a query parameter.
+func (b *Bot) llmURL(endpoint, model string) string {
+	p := b.llmProvider(model)
+	if p.Type == "azure" {
+		name, _ := splitModel(model)
+		return fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s",
+			p.URL, url.PathEscape(name), endpoint, url.QueryEscape(b.config.AzureAPIVersion))
+	}
+	return fmt.Sprintf("%s/%s", p.URL, endpoint)
+}
+
+// newLLMRequest returns a JSON POST request to url, authenticated the way
+// the provider of model expects.
+func (b *Bot) newLLMRequest(ctx context.Context, url, model string, payload []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	if p := b.llmProvider(model); p.Type == "azure" {
+		req.Header.Add("api-key", p.Key)
+	} else {
+		req.Header.Add("Authorization", "Bearer "+p.Key)
+	}
+	return req, nil
+}
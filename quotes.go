@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// quoteLinkRe finds the "RE: <link>" line other software adds to quote posts.
+var quoteLinkRe = regexp.MustCompile(`(?i)RE:\s*(?:<a[^>]+href="([^"]+)"|(https?://\S+))`)
+
+// quotedStatuses resolves the statuses quoted by a thread's statuses, keyed
+// by the ID of the quoting status. The quote fields, which take a request of
+// their own, are only checked on the newest status, the one being answered;
+// older ones are checked for a "RE:" link.
+func (b *Bot) quotedStatuses(ctx context.Context, stack []*models.Status) map[string]*models.Status {
+	quotes := map[string]*models.Status{}
+	for i, status := range stack {
+		if quoted := b.quotedStatus(ctx, status, i == 0); quoted != nil {
+			quotes[status.ID] = quoted
+		}
+	}
+	return quotes
+}
+
+// quotedStatus returns the status that status quotes, or nil if there is none
+// or it cannot be resolved. Unless checkFields is set, only a "RE:" link in
+// its text is looked for.
+func (b *Bot) quotedStatus(ctx context.Context, status *models.Status, checkFields bool) *models.Status {
+	if checkFields {
+		quoted, err := b.backend.QuotedStatus(ctx, status)
+		if err != nil {
+			log.Printf("Failed to check status %s for a quote: %v", status.ID, err)
+		}
+		if quoted != nil {
+			return quoted
+		}
+	}
+
+	if m := quoteLinkRe.FindStringSubmatch(status.Content + "\n" + status.Text); m != nil {
+		link := m[1]
+		if link == "" {
+			link = m[2]
+		}
+		return b.resolveStatus(ctx, link)
+	}
+	return nil
+}
+
+// resolveStatus looks up a status by its URL, fetching it from its server if necessary.
+func (b *Bot) resolveStatus(ctx context.Context, link string) *models.Status {
+	quoted, err := b.backend.SearchStatus(ctx, link)
+	if err != nil {
+		log.Printf("Failed to resolve quoted status %s: %v", link, err)
+	}
+	return quoted
+}
+
+// quoteText marks the text of a quoted status as quoted material for the model.
+func quoteText(quoted *models.Status, notes string) string {
+	author := "unknown"
+	if quoted.Account != nil {
+		author = "@" + quoted.Account.Acct
+	}
+	return fmt.Sprintf("[Quoted post by %s]\n%s%s\n[End of quoted post]", author, statusText(quoted), notes)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// Actions FAVOURITE_ACTION and REACTION_ACTIONS may ask for.
+const (
+	actionNone        = "none"
+	actionReciprocate = "reciprocate"
+	actionRegenerate  = "regenerate"
+)
+
+var reactionActions = []string{actionNone, actionReciprocate, actionRegenerate}
+
+// handleReaction acts on a favourite of, or an emoji reaction to, one of the
+// bot's statuses, as FAVOURITE_ACTION and REACTION_ACTIONS say.
+func (b *Bot) handleReaction(ctx context.Context, notif *models.Notification) {
+	if notif.Status == nil || notif.Account == nil {
+		return
+	}
+	emoji, isReaction := reactionEmoji(notif)
+	action := b.config.FavouriteAction
+	if isReaction {
+		action = b.config.ReactionActions[emoji]
+		if action == "" {
+			action = b.config.ReactionActions["*"]
+		}
+	}
+
+	switch action {
+	case actionReciprocate:
+		b.reciprocate(ctx, notif, emoji)
+	case actionRegenerate:
+		b.regenerate(ctx, notif)
+	}
+}
+
+// reciprocate reacts in kind to the post of the reacting account that the
+// bot's status answered.
+func (b *Bot) reciprocate(ctx context.Context, notif *models.Notification, emoji string) {
+	answered := b.answeredStatus(ctx, notif.Status, notif.Account)
+	if answered == nil {
+		return
+	}
+	if err := b.backend.React(ctx, answered.ID, emoji); err != nil {
+		log.Printf("Failed to react to %s: %v", answered.ID, err)
+	}
+}
+
+// regenerate answers again the post that the bot's status replied to, once
+// per reply and only for the post's author.
+func (b *Bot) regenerate(ctx context.Context, notif *models.Notification) {
+	answered := b.answeredStatus(ctx, notif.Status, notif.Account)
+	if answered == nil {
+		return
+	}
+	if !b.replies.claimKey("regenerate:"+notif.Status.ID, notif.ID, b.fullAcct(notif.Account.Acct)) {
+		log.Printf("Not regenerating %s again", notif.Status.ID)
+		return
+	}
+	mention := &models.Notification{ID: notif.ID, Type: "mention", Account: notif.Account, Status: answered}
+	if b.screenSpam(ctx, mention) {
+		return
+	}
+	log.Printf("Regenerating the reply to %s for %s", answered.ID, notif.Account.Acct)
+	b.answer(ctx, jobMention, mention)
+}
+
+// answeredStatus returns the post that status, by the bot, answers, going up
+// through the earlier parts of a split reply, if account wrote it.
+func (b *Bot) answeredStatus(ctx context.Context, status *models.Status, account *models.Account) *models.Status {
+	for i := 0; i <= b.config.MaxContinuationPosts && status.InReplyToID != ""; i++ {
+		parent, err := b.backend.GetStatus(ctx, status.InReplyToID)
+		if err != nil {
+			log.Printf("Failed to get status: %v", err)
+			return nil
+		}
+		if parent.Account == nil {
+			return nil
+		}
+		if !b.isBotAccount(parent.Account.Acct) {
+			if b.fullAcct(parent.Account.Acct) != b.fullAcct(account.Acct) {
+				return nil
+			}
+			return parent
+		}
+		status = parent
+	}
+	return nil
+}
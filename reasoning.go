@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var thinkBlockRe = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+// isReasoningModel reports whether model is listed in REASONING_MODELS,
+// either by name or as the prefix of a dated or sized variant ("o1" covers "o1-mini").
+func (b *Bot) isReasoningModel(model string) bool {
+	model, _ = splitModel(model)
+	for _, m := range b.config.ReasoningModels {
+		if model == m || strings.HasPrefix(model, m+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// reasoningMessages adapts a chat history for reasoning models, which reject
+// the system role: the system prompt is sent as the first user turn, and
+// consecutive messages of the same role are merged.
+func reasoningMessages(messages []Message) []Message {
+	var out []Message
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			msg.Role = "user"
+		}
+		if n := len(out); n > 0 && out[n-1].Role == msg.Role {
+			merged := append([]ChatContent{}, out[n-1].ChatContent...)
+			out[n-1].ChatContent = append(merged, msg.ChatContent...)
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// stripReasoning removes chain-of-thought that some models return inline as
+// <think>…</think> blocks, so it is never posted.
+func stripReasoning(content string) string {
+	content = thinkBlockRe.ReplaceAllString(content, "")
+	// The opening tag may have been part of the prompt template.
+	if _, after, ok := strings.Cut(content, "</think>"); ok {
+		content = after
+	}
+	// A block cut off by the token limit is never closed.
+	if before, _, ok := strings.Cut(content, "<think>"); ok {
+		content = before
+	}
+	return strings.TrimSpace(content)
+}
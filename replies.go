@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const (
+	replyLogFile      = "replies.json"
+	replyLogRetention = 30 * 24 * time.Hour
+)
+
+// replyRecord notes that a status was, or is being, answered.
+type replyRecord struct {
+	NotificationID string    `json:"notification_id"`
+	Acct           string    `json:"acct,omitempty"`
+	ReplyID        string    `json:"reply_id,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// replyLog records the statuses the bot has taken on, keyed by status ID, so
+// that a notification delivered twice, or handled again after a crash, is
+// answered at most once.
+type replyLog struct {
+	mu      sync.Mutex
+	dir     dataDir
+	Replies map[string]replyRecord `json:"replies"`
+}
+
+func newReplyLog(dir dataDir) *replyLog {
+	l := &replyLog{dir: dir}
+	if err := dir.load(replyLogFile, l); err != nil {
+		log.Printf("Failed to load reply log: %v", err)
+	}
+	if l.Replies == nil {
+		l.Replies = map[string]replyRecord{}
+	}
+	return l
+}
+
+func (l *replyLog) reset() {
+	l.Replies = map[string]replyRecord{}
+}
+
+// claim records that notif's status, by acct, is being answered and reports
+// whether it had not been claimed before. The claim is saved before the
+// reply is generated: after a crash the status stays unanswered rather than
+// being answered twice.
+func (l *replyLog) claim(notif *models.Notification, acct string) bool {
+	return l.claimKey(notif.Status.ID, notif.ID, acct)
+}
+
+// claimKey records that the work identified by key is being done for the
+// notification from acct and reports whether it had not been claimed before.
+func (l *replyLog) claimKey(key, notificationID, acct string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.dir.sync(replyLogFile, l, l.reset)()
+
+	if _, ok := l.Replies[key]; ok {
+		return false
+	}
+	now := time.Now()
+	l.Replies[key] = replyRecord{NotificationID: notificationID, Acct: acct, Time: now}
+	for id, r := range l.Replies {
+		if now.Sub(r.Time) > replyLogRetention {
+			delete(l.Replies, id)
+		}
+	}
+	l.save()
+	return true
+}
+
+// replied records the reply posted to status.
+func (l *replyLog) replied(statusID, replyID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.dir.sync(replyLogFile, l, l.reset)()
+
+	r, ok := l.Replies[statusID]
+	if !ok {
+		r.Time = time.Now()
+	}
+	r.ReplyID = replyID
+	l.Replies[statusID] = r
+	l.save()
+}
+
+// forget deletes the records of the statuses of acct and returns how many
+// there were.
+func (l *replyLog) forget(acct string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.dir.sync(replyLogFile, l, l.reset)()
+
+	n := 0
+	for key, r := range l.Replies {
+		if r.Acct == acct {
+			delete(l.Replies, key)
+			n++
+		}
+	}
+	if n > 0 {
+		l.save()
+	}
+	return n
+}
+
+func (l *replyLog) save() {
+	if err := l.dir.save(replyLogFile, l); err != nil {
+		log.Printf("Failed to save reply log: %v", err)
+	}
+}
+
+// claimReply reports whether the bot should answer notif: its status has
+// not been taken on before and has no reply from the bot in its thread.
+func (b *Bot) claimReply(ctx context.Context, notif *models.Notification) bool {
+	if notif.Status == nil {
+		return false
+	}
+	if !b.replies.claim(notif, b.fullAcct(notif.Status.Account.Acct)) {
+		log.Printf("Skipping notification %s: status %s was already answered", notif.ID, notif.Status.ID)
+		return false
+	}
+	if reply := b.existingReply(ctx, notif.Status); reply != nil {
+		log.Printf("Skipping notification %s: status %s already has reply %s", notif.ID, notif.Status.ID, reply.ID)
+		b.replies.replied(notif.Status.ID, reply.ID)
+		return false
+	}
+	return true
+}
+
+// existingReply returns a reply by the bot to status, if there is one.
+func (b *Bot) existingReply(ctx context.Context, status *models.Status) *models.Status {
+	if status.RepliesCount == 0 {
+		return nil
+	}
+	_, descendants, err := b.backend.ThreadContext(ctx, status.ID)
+	if err != nil {
+		log.Printf("Failed to check for existing replies: %v", err)
+		return nil
+	}
+	for _, descendant := range descendants {
+		if descendant.InReplyToID == status.ID && descendant.Account != nil && b.isBotAccount(descendant.Account.Acct) {
+			return descendant
+		}
+	}
+	return nil
+}
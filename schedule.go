@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Schedule is a standalone post the bot generates on a cron schedule. The
+// prompt may use {date}, {time} and {weekday}, which are filled in with the
+// time of the run.
+type Schedule struct {
+	Name        string `json:"name"`
+	Cron        string `json:"cron"`
+	Prompt      string `json:"prompt"`
+	Visibility  string `json:"visibility,omitempty"`
+	Model       string `json:"model,omitempty"`
+	Persona     string `json:"persona,omitempty"`
+	Language    string `json:"language,omitempty"`
+	SpoilerText string `json:"spoiler_text,omitempty"`
+
+	spec *cronSpec
+}
+
+// loadSchedules reads the schedules from file, skipping any with an invalid cron expression.
+func loadSchedules(file string) []*Schedule {
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Printf("Failed to read schedules: %v", err)
+		return nil
+	}
+	var all []*Schedule
+	if err := json.Unmarshal(data, &all); err != nil {
+		log.Printf("Failed to parse schedules: %v", err)
+		return nil
+	}
+
+	var schedules []*Schedule
+	for _, s := range all {
+		spec, err := parseCron(s.Cron)
+		if err != nil {
+			log.Printf("Skipping schedule %q: %v", s.Name, err)
+			continue
+		}
+		s.spec = spec
+		if s.Visibility == "" {
+			s.Visibility = "unlisted"
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules
+}
+
+// runSchedules checks the schedules and feeds at the start of every minute
+// and runs the ones that are due, until stop is closed. Runs missed while the
+// bot was down are not caught up.
+func (b *Bot) runSchedules(ctx context.Context, stop <-chan struct{}) {
+	if len(b.schedules) == 0 && len(b.feeds) == 0 {
+		return
+	}
+	log.Printf("Running %d scheduled posts and %d feeds", len(b.schedules), len(b.feeds))
+	for {
+		now := time.Now()
+		select {
+		case <-stop:
+			return
+		case <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+		}
+
+		t := time.Now().In(b.config.ScheduleTimezone).Truncate(time.Minute)
+		for _, s := range b.schedules {
+			if s.spec.matches(t) {
+				b.tasks.Add(1)
+				go func() {
+					defer b.tasks.Done()
+					b.runSchedule(ctx, s, t)
+				}()
+			}
+		}
+		b.runFeeds(ctx, t)
+	}
+}
+
+func (b *Bot) runSchedule(ctx context.Context, s *Schedule, t time.Time) {
+	persona := b.personas.find(s.Persona)
+	model := s.Model
+	if model == "" {
+		model = b.personaModel(persona)
+	}
+	prompt := strings.NewReplacer(
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("15:04"),
+		"{weekday}", t.Weekday().String(),
+	).Replace(s.Prompt)
+
+	chatHistory := []Message{
+		{Role: "system", ChatContent: []ChatContent{{Type: "text", Text: renderPrompt(b.personaSystemPrompt(persona), b.promptVars(nil, persona))}}},
+		{Role: "user", ChatContent: []ChatContent{{Type: "text", Text: prompt}}},
+	}
+	completion, err := b.completeWithFallback(ctx, chatHistory, model, b.configuredParams())
+	b.usage.record(b.fullAcct(b.config.BotAccountName), completion.Usage)
+	if err != nil {
+		log.Printf("Failed to generate scheduled post %q: %v", s.Name, err)
+		return
+	}
+	if completion.Content == "" || b.moderateOutput(ctx, b.config.BotAccountName, completion.Content) {
+		log.Printf("Not posting scheduled post %q: empty or flagged", s.Name)
+		return
+	}
+
+	post := &StatusPost{
+		ContentType: "text/markdown",
+		Visibility:  s.Visibility,
+		Language:    s.Language,
+		SpoilerText: b.autoContentWarning(s.SpoilerText, s.Language),
+	}
+	if b.postThread(ctx, post, "", "", b.splitReply(decorateReply(persona, b.fixEmoji(ctx, completion.Content)), b.config.MaxChar)) != nil {
+		log.Printf("Posted scheduled post %q", s.Name)
+	}
+}
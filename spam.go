@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const (
+	cooldownsFile = "cooldowns.json"
+	// offenceRetention is how long a past cooldown counts towards a block.
+	offenceRetention = 30 * 24 * time.Hour
+)
+
+// cooldown is an account's current or last cooldown and how many it has had.
+type cooldown struct {
+	Until    time.Time `json:"until"`
+	Offences int       `json:"offences"`
+}
+
+type recentMention struct {
+	time     time.Time
+	statusID string
+	text     string
+}
+
+// spamGuard tracks the recent mentions of each account to spot floods, and
+// the cooldowns given to accounts that sent them.
+type spamGuard struct {
+	mu        sync.Mutex
+	dir       dataDir
+	Cooldowns map[string]*cooldown `json:"cooldowns"`
+	mentions  map[string][]recentMention
+}
+
+func newSpamGuard(dir dataDir) *spamGuard {
+	g := &spamGuard{dir: dir, mentions: map[string][]recentMention{}}
+	if err := dir.load(cooldownsFile, g); err != nil {
+		log.Printf("Failed to load cooldowns: %v", err)
+	}
+	if g.Cooldowns == nil {
+		g.Cooldowns = map[string]*cooldown{}
+	}
+	return g
+}
+
+func (g *spamGuard) reset() {
+	g.Cooldowns = map[string]*cooldown{}
+}
+
+func (g *spamGuard) coolingDown(acct string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	defer g.dir.sync(cooldownsFile, g, g.reset)()
+
+	c := g.Cooldowns[acct]
+	return c != nil && now.Before(c.Until)
+}
+
+// record adds a mention by acct, unless it was delivered before, and returns
+// how many of its mentions, and how many with the same text, were sent
+// within window.
+func (g *spamGuard) record(acct, statusID, text string, now time.Time, window time.Duration) (total, same int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for a, list := range g.mentions {
+		if now.Sub(list[len(list)-1].time) > window {
+			delete(g.mentions, a)
+		}
+	}
+	var kept []recentMention
+	seen := false
+	for _, m := range g.mentions[acct] {
+		if now.Sub(m.time) <= window {
+			kept = append(kept, m)
+			seen = seen || m.statusID == statusID
+		}
+	}
+	if !seen {
+		kept = append(kept, recentMention{time: now, statusID: statusID, text: text})
+	}
+	g.mentions[acct] = kept
+
+	for _, m := range kept {
+		if m.text == text {
+			same++
+		}
+	}
+	return len(kept), same
+}
+
+// penalize puts acct on cooldown until the given time and returns how many
+// cooldowns it has had.
+func (g *spamGuard) penalize(acct string, until time.Time) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	defer g.dir.sync(cooldownsFile, g, g.reset)()
+
+	now := time.Now()
+	for a, c := range g.Cooldowns {
+		if now.Sub(c.Until) > offenceRetention {
+			delete(g.Cooldowns, a)
+		}
+	}
+	c := g.Cooldowns[acct]
+	if c == nil {
+		c = &cooldown{}
+		g.Cooldowns[acct] = c
+	}
+	c.Until = until
+	c.Offences++
+	// Start counting afresh once the cooldown is over.
+	delete(g.mentions, acct)
+
+	if err := g.dir.save(cooldownsFile, g); err != nil {
+		log.Printf("Failed to save cooldowns: %v", err)
+	}
+	return c.Offences
+}
+
+// screenSpam reports whether a mention should be ignored as spam: its author
+// is cooling down, is on a server listed in SPAM_DOMAINS, or is flooding the
+// bot. Floods put the author on a cooldown of SPAM_COOLDOWN, and repeated
+// ones get them blocked; the admins are told either way.
+func (b *Bot) screenSpam(ctx context.Context, notif *models.Notification) bool {
+	if notif.Account == nil || notif.Status == nil {
+		return false
+	}
+	acct := b.fullAcct(notif.Account.Acct)
+	if b.isAdmin(acct) {
+		return false
+	}
+	now := time.Now()
+	if b.spam.coolingDown(acct, now) {
+		log.Printf("Ignoring mention %s from %s, who is cooling down", notif.ID, acct)
+		return true
+	}
+
+	lang := b.config.DefaultLanguage
+	if b.isSpamDomain(acct) {
+		b.blockSpammer(ctx, acct, b.catalog.message(lang, "spam.reason.domain"))
+		return true
+	}
+
+	total, same := b.spam.record(acct, notif.Status.ID, spamText(notif.Status), now, b.config.SpamWindow)
+	var reason string
+	switch {
+	case b.config.SpamRepeatLimit > 0 && same >= b.config.SpamRepeatLimit:
+		reason = fmt.Sprintf(b.catalog.message(lang, "spam.reason.repeated"), same, b.config.SpamWindow)
+	case b.config.SpamNewAccountLimit > 0 && total > b.config.SpamNewAccountLimit && isNewAccount(notif.Account, b.config.SpamNewAccountAge, now):
+		reason = fmt.Sprintf(b.catalog.message(lang, "spam.reason.new_account"), total, b.config.SpamWindow)
+	default:
+		return false
+	}
+
+	offences := b.spam.penalize(acct, now.Add(b.config.SpamCooldown))
+	if b.config.SpamBlockAfter > 0 && offences >= b.config.SpamBlockAfter {
+		b.blockSpammer(ctx, acct, reason)
+		return true
+	}
+	log.Printf("Cooling down %s for %v: %s", acct, b.config.SpamCooldown, reason)
+	b.notifyAdmins(ctx, fmt.Sprintf(b.catalog.message(lang, "spam.cooldown"), acct, b.config.SpamCooldown, reason))
+	return true
+}
+
+func (b *Bot) blockSpammer(ctx context.Context, acct, reason string) {
+	log.Printf("Blocking %s: %s", acct, reason)
+	b.blocked.block(acct)
+	b.notifyAdmins(ctx, fmt.Sprintf(b.catalog.message(b.config.DefaultLanguage, "spam.blocked"), acct, reason))
+}
+
+// isSpamDomain reports whether acct is on a server in SPAM_DOMAINS or one of their subdomains.
+func (b *Bot) isSpamDomain(acct string) bool {
+	_, domain, _ := strings.Cut(acct, "@")
+	domain = strings.ToLower(domain)
+	for _, d := range b.config.SpamDomains {
+		d = strings.ToLower(strings.TrimPrefix(d, "."))
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNewAccount reports whether account was created less than age ago. The
+// age of accounts whose servers do not say is unknown, and not new.
+func isNewAccount(account *models.Account, age time.Duration, now time.Time) bool {
+	created, err := time.Parse(time.RFC3339, account.CreatedAt)
+	return err == nil && now.Sub(created) < age
+}
+
+// spamText normalizes the text of a mention for comparison, dropping
+// mentions, hashtags, case and spacing.
+func spamText(status *models.Status) string {
+	text := mentionOrTagRe.ReplaceAllString(statusText(status), " ")
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// counterReserve is the room kept for a " (n/m)" counter on each post of a split reply.
+const counterReserve = len(" (10/10)")
+
+// splitBoundaries are the places a long reply is preferably split at, best first:
+// paragraph breaks, line breaks, sentence ends, clause breaks, then any space.
+var splitBoundaries = []*regexp.Regexp{
+	regexp.MustCompile(`\n[ \t]*\n`),
+	regexp.MustCompile(`\n`),
+	regexp.MustCompile(`[.!?…]["'”’)\]]*\s|[。！？][」』”’）]*`),
+	regexp.MustCompile(`[,;:]\s|[，；：、]`),
+	regexp.MustCompile(`\s`),
+}
+
+var fenceRe = regexp.MustCompile("^(```+|~~~+)")
+
+// splitReply splits text into posts of at most limit characters, numbered
+// "(1/3)" and so on. A code fence that a split falls inside is closed at the
+// end of the post and reopened at the start of the next one. Anything beyond
+// MAX_CONTINUATION_POSTS follow-up posts is cut off with an ellipsis; with
+// none allowed, the single post has no counter.
+func (b *Bot) splitReply(text string, limit int) []string {
+	if statusLength(text) <= limit {
+		return []string{text}
+	}
+	if b.config.MaxContinuationPosts > 0 {
+		limit -= counterReserve
+	}
+
+	var parts []string
+	for text != "" {
+		if statusLength(text) <= limit {
+			parts = append(parts, text)
+			break
+		}
+		last := len(parts) >= b.config.MaxContinuationPosts
+		room := limit
+		if last {
+			room -= len("\n…")
+		}
+
+		cut := splitPoint(text, room)
+		opening, marker := openFence(text[:cut])
+		if opening != "" {
+			// Make room for the closing fence.
+			cut = splitPoint(text, room-1-len(marker))
+			opening, marker = openFence(text[:cut])
+			if strings.TrimSpace(text[:cut]) == opening {
+				// Nothing but the fence itself would fit; split the line instead.
+				cut = statusCut(text, room)
+				opening = ""
+			}
+		}
+
+		part, rest := strings.TrimSpace(text[:cut]), text[cut:]
+		if opening != "" {
+			part += "\n" + marker
+			rest = opening + "\n" + strings.TrimLeft(rest, "\n")
+		} else {
+			rest = strings.TrimSpace(rest)
+		}
+
+		if last {
+			if opening != "" {
+				part += "\n"
+			}
+			parts = append(parts, part+"…")
+			break
+		}
+		parts = append(parts, part)
+		text = rest
+	}
+
+	if len(parts) == 1 {
+		return parts
+	}
+	for i, part := range parts {
+		sep := " "
+		if fenceRe.MatchString(part[strings.LastIndex(part, "\n")+1:]) {
+			// Text after a closing fence would turn it into an opening one.
+			sep = "\n"
+		}
+		parts[i] = fmt.Sprintf("%s%s(%d/%d)", part, sep, i+1, len(parts))
+	}
+	return parts
+}
+
+// openFence returns the opening line and the closing marker of the markdown
+// code fence left open at the end of text, or empty strings if there is none.
+func openFence(text string) (opening, marker string) {
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		run := fenceRe.FindString(trimmed)
+		switch {
+		case marker == "" && run != "":
+			opening, marker = trimmed, run
+		case marker != "" && run != "" && run[0] == marker[0] && len(run) >= len(marker) && trimmed == run:
+			opening, marker = "", ""
+		}
+	}
+	return opening, marker
+}
+
+// splitPoint returns where to end a post of at most limit characters taken
+// from the start of text: at the best boundary that keeps at least half of
+// what would fit, or else wherever the limit is reached.
+func splitPoint(text string, limit int) int {
+	cut := statusCut(text, limit)
+	for _, re := range splitBoundaries {
+		locs := re.FindAllStringIndex(text[:cut], -1)
+		if len(locs) == 0 {
+			continue
+		}
+		if end := locs[len(locs)-1][1]; end >= cut/2 {
+			return end
+		}
+	}
+	return cut
+}
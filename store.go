@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// stateLockTTL bounds how long a crashed process can hold a store's lock.
+	stateLockTTL = 10 * time.Second
+	// stateLockWait is how long to wait for a store's lock before going ahead without it.
+	stateLockWait = 10 * time.Second
+)
+
+// releaseLockScript deletes a lock only if it is still the caller's.
+const releaseLockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+
+// loadJSON reads dir/name into v. A missing file is not an error.
+func loadJSON(dir, name string, v any) error {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// dataDir is the directory a store keeps its files in. A read-only one, as
+// in DRY_RUN mode, loads them but saves nothing, so a dry run leaves no
+// replies recorded, cursors moved or usage counted. With QUEUE_URL set the
+// stores are kept in Redis instead, shared by the poller and its workers.
+type dataDir struct {
+	path     string
+	readOnly bool
+	shared   *sharedState
+}
+
+func (d dataDir) load(name string, v any) error {
+	if d.shared != nil {
+		data, err := d.shared.get(name)
+		if err != nil {
+			return err
+		}
+		if data != nil {
+			return json.Unmarshal(data, v)
+		}
+		// Until it is first saved, the state carries on from the file.
+	}
+	return loadJSON(d.path, name, v)
+}
+
+func (d dataDir) save(name string, v any) error {
+	if d.readOnly {
+		return nil
+	}
+	if d.shared != nil {
+		return d.shared.set(name, v)
+	}
+	return saveJSON(d.path, name, v)
+}
+
+// sync brings v, the state of a store, up to date when it is shared with
+// other processes: it takes the store's lock and reloads v, after reset has
+// emptied it. It returns the function that releases the lock, which the
+// store's method defers. Without shared state it does nothing.
+func (d dataDir) sync(name string, v any, reset func()) (unlock func()) {
+	if d.shared == nil {
+		return func() {}
+	}
+	unlock = d.shared.lock(name)
+	data, err := d.shared.get(name)
+	if err != nil {
+		log.Printf("Failed to reload %s, using the state last loaded: %v", name, err)
+		return unlock
+	}
+	if data != nil {
+		reset()
+		if err := json.Unmarshal(data, v); err != nil {
+			log.Printf("Failed to parse %s: %v", name, err)
+		}
+	}
+	return unlock
+}
+
+// sharedState keeps the state of the stores in Redis, one key per store
+// below QUEUE_NAME:state, each with a lock taken while it is changed.
+type sharedState struct {
+	redis  *redisClient
+	prefix string
+}
+
+func newSharedState(redis *redisClient, name string) *sharedState {
+	return &sharedState{redis: redis, prefix: name + ":state:"}
+}
+
+// get returns the saved state of a store, or nil if there is none.
+func (s *sharedState) get(name string) ([]byte, error) {
+	reply, err := s.redis.do(context.Background(), "GET", s.prefix+name)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	data, _ := reply.(string)
+	return []byte(data), nil
+}
+
+func (s *sharedState) set(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.redis.do(context.Background(), "SET", s.prefix+name, string(data))
+	return err
+}
+
+// lock takes the lock of a store, waiting up to stateLockWait, and returns
+// the function that releases it. If the lock cannot be had, the caller goes
+// ahead without it rather than stall.
+func (s *sharedState) lock(name string) func() {
+	key := s.prefix + name + ":lock"
+	token := make([]byte, 16)
+	rand.Read(token)
+	value := hex.EncodeToString(token)
+	ctx := context.Background()
+	deadline := time.Now().Add(stateLockWait)
+	for {
+		reply, err := s.redis.do(ctx, "SET", key, value, "NX", "PX", strconv.FormatInt(stateLockTTL.Milliseconds(), 10))
+		if err == nil && reply == "OK" {
+			return func() {
+				if _, err := s.redis.do(ctx, "EVAL", releaseLockScript, "1", key, value); err != nil {
+					log.Printf("Failed to release the lock of %s: %v", name, err)
+				}
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to lock %s, going ahead without the lock: %v", name, err)
+			return func() {}
+		}
+		if time.Now().After(deadline) {
+			log.Printf("Timed out waiting for the lock of %s, going ahead without it", name)
+			return func() {}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// saveJSON atomically writes v to dir/name.
+func saveJSON(dir, name string, v any) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+// draftEllipsis marks a reply that is still being written.
+const draftEllipsis = " …"
+
+// replyDraft is a placeholder reply that is edited while a streamed
+// completion arrives, and finalized once it is complete.
+type replyDraft struct {
+	status *models.Status // the status being replied to
+	reply  *models.Status
+	edited time.Time
+	shown  string
+}
+
+// startDraft posts the placeholder reply, or returns nil if it cannot.
+func (b *Bot) startDraft(ctx context.Context, status *models.Status) *replyDraft {
+	// Posted directly, since a placeholder is not worth queueing in the outbox.
+	post := b.replyParams(status)
+	post.Text = replyMention(status) + b.catalog.message(status.Language, "reply.thinking")
+	post.InReplyToID = status.ID
+	reply, err := b.backend.PostStatus(ctx, post)
+	if err != nil {
+		log.Printf("Failed to post placeholder reply: %v", err)
+		return nil
+	}
+	b.replies.replied(status.ID, reply.ID)
+	return &replyDraft{status: status, reply: reply, edited: time.Now()}
+}
+
+// updateDraft shows the text generated so far, as much as fits in the first
+// post, editing at most once every STREAM_EDIT_INTERVAL.
+func (b *Bot) updateDraft(ctx context.Context, d *replyDraft, text string) {
+	if time.Since(d.edited) < b.config.StreamEditInterval {
+		return
+	}
+	text = stripReasoning(text)
+	text = strings.TrimSpace(text[:statusCut(text, b.replyLimit(d.status)-statusLength(draftEllipsis))])
+	if text == "" || text == d.shown {
+		return
+	}
+
+	d.shown, d.edited = text, time.Now()
+	if err := b.backend.EditStatus(ctx, d.reply, replyMention(d.status)+text+draftEllipsis); err != nil {
+		log.Printf("Failed to update streamed reply: %v", err)
+	}
+}
+
+// finishDraft replaces the placeholder with the first part of the final
+// response and posts the rest below it.
+func (b *Bot) finishDraft(ctx context.Context, d *replyDraft, response string) {
+	parts := b.splitReply(response, b.replyLimit(d.status))
+	if err := b.backend.EditStatus(ctx, d.reply, replyMention(d.status)+parts[0]); err != nil {
+		log.Printf("Failed to finalize streamed reply: %v", err)
+	}
+	b.postChain(ctx, d.status, b.replyParams(d.status), d.reply.ID, parts[1:])
+}
+
+func (b *Bot) discardDraft(ctx context.Context, d *replyDraft) {
+	if err := b.backend.DeleteStatus(ctx, d.reply.ID); err != nil {
+		log.Printf("Failed to delete streamed reply: %v", err)
+	}
+}
+
+// streamGPT is callGPT with the response streamed into draft as it is generated.
+func (b *Bot) streamGPT(ctx context.Context, chatHistory []Message, model string, params GenerationParams, draft *replyDraft) *Completion {
+	completion, err := b.routeVision(chatHistory, model, b.withFallback(func(chatHistory []Message, model string) (*Completion, error) {
+		return b.chatCompletionStream(ctx, chatHistory, model, params, func(text string) {
+			b.updateDraft(ctx, draft, text)
+		})
+	}))
+	if err != nil {
+		log.Printf("Failed to stream from GPT service: %v", err)
+		completion.Content = b.catalog.message(draft.status.Language, "error.gpt")
+	}
+	return completion
+}
+
+// chatCompletionStream requests a streamed completion and calls onText with
+// the text received so far after every chunk. Like chatCompletion, it always
+// returns a non-nil completion.
+func (b *Bot) chatCompletionStream(ctx context.Context, chatHistory []Message, model string, params GenerationParams, onText func(string)) (*Completion, error) {
+	completion := &Completion{}
+	request := b.chatRequest(chatHistory, model, params)
+	request["stream"] = true
+	request["stream_options"] = map[string]interface{}{"include_usage": true}
+
+	res, err := b.postChatRequest(withStreamedResponse(ctx), request)
+	if err != nil {
+		return completion, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return completion, fmt.Errorf("GPT service returned status %d: %s", res.StatusCode, msg)
+	}
+
+	var content strings.Builder
+	var toolCalls []ToolCall
+	received := false
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+
+		// The final chunk carries the usage and no choices.
+		if usage := parseTokenUsage(chunk["usage"]); usage != nil {
+			completion.Usage = usage
+		}
+		if m, ok := chunk["model"].(string); ok && m != "" {
+			completion.Model = m
+		}
+		if fp, ok := chunk["system_fingerprint"].(string); ok && fp != "" {
+			completion.SystemFingerprint = fp
+		}
+		collectSafetyAnnotations(completion, chunk)
+
+		choices, _ := chunk["choices"].([]interface{})
+		if len(choices) == 0 {
+			continue
+		}
+		received = true
+		choice, _ := choices[0].(map[string]interface{})
+		if reason, ok := choice["finish_reason"].(string); ok {
+			completion.FinishReason = reason
+		}
+		collectSafetyAnnotations(completion, choice)
+
+		delta, _ := choice["delta"].(map[string]interface{})
+		if refusal, ok := delta["refusal"].(string); ok {
+			completion.Refusal += refusal
+		}
+		toolCalls = appendToolCallDeltas(toolCalls, delta["tool_calls"])
+		if text, ok := delta["content"].(string); ok && text != "" {
+			content.WriteString(text)
+			onText(content.String())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return completion, err
+	}
+	if !received {
+		return completion, errors.New("no choices in GPT stream")
+	}
+
+	completion.Content = stripReasoning(content.String())
+	completion.ToolCalls = toolCalls
+	return completion, nil
+}
+
+// appendToolCallDeltas merges the tool call fragments of a stream chunk into
+// calls. The name arrives with the first fragment of each call, and the
+// arguments are spread over many.
+func appendToolCallDeltas(calls []ToolCall, v interface{}) []ToolCall {
+	list, _ := v.([]interface{})
+	for _, item := range list {
+		fragment, _ := item.(map[string]interface{})
+		index, _ := fragment["index"].(float64)
+		for int(index) >= len(calls) {
+			calls = append(calls, ToolCall{})
+		}
+		function, _ := fragment["function"].(map[string]interface{})
+		if name, ok := function["name"].(string); ok && name != "" {
+			calls[int(index)].Name = name
+		}
+		arguments, _ := function["arguments"].(string)
+		calls[int(index)].Arguments += arguments
+	}
+	return calls
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const (
+	defaultReplyPrompt  = `You are commenting on a new post by an account you follow. Reply to it briefly.`
+	defaultNotifyPrompt = `Summarize the post in one or two sentences for the bot's admins.`
+)
+
+// Subscription is a rule for the new posts of an account the bot follows
+// with notifications on. Action "reply" answers the post; "notify" sends the
+// admins a direct message with a summary and the link.
+type Subscription struct {
+	Account string `json:"account"`
+	Action  string `json:"action"`
+	Prompt  string `json:"prompt,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Persona string `json:"persona,omitempty"`
+	// Keywords, if set, limit the rule to posts containing any of them.
+	Keywords []string `json:"keywords,omitempty"`
+	// Replies includes the account's replies, which are skipped by default.
+	Replies bool `json:"replies,omitempty"`
+}
+
+func loadSubscriptions(file string) []*Subscription {
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Printf("Failed to read subscriptions: %v", err)
+		return nil
+	}
+	var subs []*Subscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		log.Printf("Failed to parse subscriptions: %v", err)
+		return nil
+	}
+	for _, sub := range subs {
+		sub.Account = strings.TrimPrefix(sub.Account, "@")
+	}
+	return subs
+}
+
+// subscription returns the rule that applies to status, if any.
+func (b *Bot) subscription(status *models.Status) *Subscription {
+	acct := b.fullAcct(status.Account.Acct)
+	for _, sub := range b.subscriptions {
+		if !strings.EqualFold(b.fullAcct(sub.Account), acct) {
+			continue
+		}
+		if status.InReplyToID != "" && !sub.Replies {
+			return nil
+		}
+		if len(sub.Keywords) == 0 {
+			return sub
+		}
+		text := strings.ToLower(statusText(status))
+		for _, keyword := range sub.Keywords {
+			if strings.Contains(text, strings.ToLower(keyword)) {
+				return sub
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// subscribe follows the accounts with subscriptions, with notifications on,
+// so their new posts arrive as status notifications.
+func (b *Bot) subscribe(ctx context.Context) {
+	for _, sub := range b.subscriptions {
+		account := b.resolveAccount(ctx, sub.Account)
+		if account == nil {
+			log.Printf("Failed to find subscribed account %s", sub.Account)
+			continue
+		}
+		if err := b.backend.Follow(ctx, account.ID, true); err != nil {
+			log.Printf("Failed to subscribe to %s: %v", sub.Account, err)
+		}
+	}
+}
+
+func (b *Bot) resolveAccount(ctx context.Context, acct string) *models.Account {
+	account, err := b.backend.SearchAccount(ctx, acct)
+	if err != nil {
+		log.Printf("Failed to resolve account %s: %v", acct, err)
+	}
+	return account
+}
+
+func (b *Bot) handleStatus(ctx context.Context, notif *models.Notification) {
+	status := notif.Status
+	if status == nil || status.Account == nil || b.mentionsBot(status) {
+		// Mentions are answered as such.
+		return
+	}
+	sub := b.subscription(status)
+	if sub == nil {
+		return
+	}
+
+	persona := b.personas.find(sub.Persona)
+	model := sub.Model
+	if model == "" {
+		model = b.personaModel(persona)
+	}
+	prompt := sub.Prompt
+	if prompt == "" && sub.Action == "notify" {
+		prompt = defaultNotifyPrompt
+	} else if prompt == "" {
+		prompt = defaultReplyPrompt
+	}
+
+	chatHistory := b.buildChatHistory(ctx, []*models.Status{status}, persona, b.systemPrompt(persona, b.promptVars(status, persona)))
+	chatHistory[0].ChatContent[0].Text += "\n\n" + prompt
+	completion, err := b.completeWithFallback(ctx, chatHistory, model, b.configuredParams())
+	b.usage.record(b.fullAcct(b.config.BotAccountName), completion.Usage)
+	if err != nil {
+		log.Printf("Failed to respond to subscribed post %s: %v", status.ID, err)
+		return
+	}
+	if completion.Content == "" || b.moderateOutput(ctx, b.config.BotAccountName, completion.Content) {
+		log.Printf("Not responding to subscribed post %s: empty or flagged", status.ID)
+		return
+	}
+
+	switch sub.Action {
+	case "reply":
+		b.replyToStatus(ctx, status, decorateReply(persona, b.fixEmoji(ctx, completion.Content)))
+	case "notify":
+		b.notifyAdmins(ctx, fmt.Sprintf(b.catalog.message("", "subscription.notify"), "@"+b.fullAcct(status.Account.Acct), completion.Content, status.URL))
+	default:
+		log.Printf("Unknown subscription action %q for %s", sub.Action, sub.Account)
+	}
+}
+
+func (b *Bot) mentionsBot(status *models.Status) bool {
+	for _, mention := range status.Mentions {
+		if b.isBotAccount(mention.Acct) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyAdmins sends text to ADMIN_ACCOUNTS in a direct message.
+func (b *Bot) notifyAdmins(ctx context.Context, text string) {
+	if len(b.config.AdminAccounts) == 0 {
+		log.Printf("No admins to notify: %s", text)
+		return
+	}
+	var prefix strings.Builder
+	for _, admin := range b.config.AdminAccounts {
+		prefix.WriteString("@" + b.fullAcct(strings.TrimPrefix(admin, "@")) + " ")
+	}
+	post := &StatusPost{ContentType: "text/markdown", Visibility: "direct"}
+	b.postThread(ctx, post, prefix.String(), "", b.splitReply(text, b.config.MaxChar-statusLength(prefix.String())))
+}
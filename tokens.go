@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const (
+	// messageTokenOverhead approximates the role and separator tokens each chat message costs.
+	messageTokenOverhead = 4
+	fallbackEncoding     = "o200k_base"
+)
+
+func init() {
+	// Use the embedded BPE ranks instead of downloading them at runtime.
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+type tokenizers struct {
+	mu    sync.Mutex
+	cache map[string]*tiktoken.Tiktoken
+}
+
+var tokenizerCache = &tokenizers{cache: map[string]*tiktoken.Tiktoken{}}
+
+func (t *tokenizers) get(model string) *tiktoken.Tiktoken {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if enc, ok := t.cache[model]; ok {
+		return enc
+	}
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		enc, err = tiktoken.GetEncoding(fallbackEncoding)
+		if err != nil {
+			log.Printf("Failed to load tokenizer for %s: %v", model, err)
+			return nil
+		}
+	}
+	t.cache[model] = enc
+	return enc
+}
+
+// countTokens returns the number of tokens text encodes to for model, or a
+// rough estimate if no tokenizer is available.
+func countTokens(model, text string) int {
+	name, _ := splitModel(model)
+	enc := tokenizerCache.get(name)
+	if enc == nil {
+		return len(text) / 3
+	}
+	return len(enc.Encode(text, nil, nil))
+}
+
+// contextBudget returns how many prompt tokens the conversation history may use for model.
+func (b *Bot) contextBudget(model, systemPrompt string) int {
+	name, _ := splitModel(model)
+	window, ok := b.config.ModelContextTokens[name]
+	if !ok {
+		window = b.config.DefaultContextTokens
+	}
+	budget := window - b.config.ResponseTokenReserve - countTokens(model, systemPrompt) - messageTokenOverhead
+	if b.config.MaxHistoryTokens > 0 && b.config.MaxHistoryTokens < budget {
+		budget = b.config.MaxHistoryTokens
+	}
+	return budget
+}
+
+// statusTokens estimates the prompt tokens a status will take up, including its images.
+func (b *Bot) statusTokens(model string, status *models.Status) int {
+	tokens := countTokens(model, statusText(status)) + messageTokenOverhead
+	for _, attachment := range status.MediaAttachments {
+		if isValidImageAttachment(attachment) {
+			tokens += b.config.ImageTokens
+		}
+	}
+	return tokens
+}
+
+// trimStackToBudget keeps the newest statuses of the stack that fit in the
+// token budget. The triggering status is always kept.
+func (b *Bot) trimStackToBudget(stack []*models.Status, model string, budget int) []*models.Status {
+	total := 0
+	for i, status := range stack {
+		total += b.statusTokens(model, status)
+		if total > budget && i > 0 {
+			return stack[:i]
+		}
+	}
+	return stack
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/owu-one/gotosocial-sdk/models"
+)
+
+const translatePrompt = `You are a translator. Translate the fediverse posts in the user message into the language with the code %q, detecting the source language yourself. Keep the formatting, hashtags and links, and the author labels of a thread. Reply with the translation only, without notes.`
+
+var languageCodeRe = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// translateCommand translates the post it replies to, or with "thread" the
+// whole thread up to it, into the given language or the language of the
+// command's post.
+func translateCommand(ctx context.Context, b *Bot, status *models.Status, args []string) string {
+	lang, thread := status.Language, false
+	for _, arg := range args {
+		switch {
+		case strings.EqualFold(arg, "thread"):
+			thread = true
+		case languageCodeRe.MatchString(arg):
+			lang = arg
+		}
+	}
+	if lang == "" {
+		lang = fallbackLanguage
+	}
+
+	if status.InReplyToID == "" {
+		return b.catalog.message(status.Language, "translate.none")
+	}
+	parent, err := b.backend.GetStatus(ctx, status.InReplyToID)
+	if err != nil {
+		log.Printf("Failed to get status to translate: %v", err)
+		return b.catalog.message(status.Language, "translate.none")
+	}
+
+	source := []*models.Status{parent}
+	if thread {
+		source = b.fetchThread(ctx, parent)
+	}
+	var sb strings.Builder
+	for i := len(source) - 1; i >= 0; i-- {
+		text := statusText(source[i])
+		if text == "" {
+			continue
+		}
+		if thread {
+			name := source[i].Account.DisplayName
+			if name == "" {
+				name = source[i].Account.Acct
+			}
+			fmt.Fprintf(&sb, "%s:\n", name)
+		}
+		sb.WriteString(text + "\n\n")
+	}
+
+	content := strings.TrimSpace(sb.String())
+	if b.config.PromptHardening {
+		content = sanitizeUntrusted(content)
+	}
+	translation, ok := b.commandCompletion(ctx, status, []Message{
+		{Role: "system", ChatContent: []ChatContent{{Type: "text", Text: fmt.Sprintf(translatePrompt, lang)}}},
+		{Role: "user", ChatContent: []ChatContent{{Type: "text", Text: content}}},
+	}, b.config.OpenAIModel)
+	if ok {
+		// The reply is written in lang rather than in the language of status.
+		status.Language = lang
+	}
+	return translation
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	usageFile          = "usage.json"
+	usageRetentionDays = 31
+)
+
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type UsageRecord struct {
+	Requests int `json:"requests"`
+	TokenUsage
+}
+
+type AccountUsage struct {
+	Acct string
+	UsageRecord
+}
+
+// usageStore keeps per-account usage, keyed by day (YYYY-MM-DD) then account.
+type usageStore struct {
+	mu   sync.Mutex
+	dir  dataDir
+	Days map[string]map[string]*UsageRecord `json:"days"`
+}
+
+func newUsageStore(dir dataDir) *usageStore {
+	s := &usageStore{dir: dir}
+	if err := dir.load(usageFile, s); err != nil {
+		log.Printf("Failed to load usage records: %v", err)
+	}
+	if s.Days == nil {
+		s.Days = map[string]map[string]*UsageRecord{}
+	}
+	return s
+}
+
+func (s *usageStore) reset() {
+	s.Days = map[string]map[string]*UsageRecord{}
+}
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
+
+func (s *usageStore) record(acct string, tokens *TokenUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.dir.sync(usageFile, s, s.reset)()
+
+	day := today()
+	if s.Days[day] == nil {
+		s.Days[day] = map[string]*UsageRecord{}
+	}
+	rec := s.Days[day][acct]
+	if rec == nil {
+		rec = &UsageRecord{}
+		s.Days[day][acct] = rec
+	}
+	rec.Requests++
+	if tokens != nil {
+		rec.PromptTokens += tokens.PromptTokens
+		rec.CompletionTokens += tokens.CompletionTokens
+		rec.TotalTokens += tokens.TotalTokens
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -usageRetentionDays).Format("2006-01-02")
+	for d := range s.Days {
+		if d < cutoff {
+			delete(s.Days, d)
+		}
+	}
+
+	if err := s.dir.save(usageFile, s); err != nil {
+		log.Printf("Failed to save usage records: %v", err)
+	}
+}
+
+func (s *usageStore) today(acct string) UsageRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.dir.sync(usageFile, s, s.reset)()
+
+	if rec := s.Days[today()][acct]; rec != nil {
+		return *rec
+	}
+	return UsageRecord{}
+}
+
+// topToday returns up to n accounts ordered by total tokens used today.
+func (s *usageStore) topToday(n int) []AccountUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.dir.sync(usageFile, s, s.reset)()
+
+	var list []AccountUsage
+	for acct, rec := range s.Days[today()] {
+		list = append(list, AccountUsage{Acct: acct, UsageRecord: *rec})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].TotalTokens != list[j].TotalTokens {
+			return list[i].TotalTokens > list[j].TotalTokens
+		}
+		return list[i].Requests > list[j].Requests
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// forget deletes the usage records of acct and returns on how many days it had any.
+func (s *usageStore) forget(acct string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.dir.sync(usageFile, s, s.reset)()
+
+	days := 0
+	for _, accts := range s.Days {
+		if _, ok := accts[acct]; ok {
+			delete(accts, acct)
+			days++
+		}
+	}
+	if days > 0 {
+		if err := s.dir.save(usageFile, s); err != nil {
+			log.Printf("Failed to save usage records: %v", err)
+		}
+	}
+	return days
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// completeFunc requests a completion of chatHistory from model.
+type completeFunc func(chatHistory []Message, model string) (*Completion, error)
+
+// routeVision sends conversations with images to VISION_MODEL, if one is
+// configured, and everything else to model. If the vision model fails, the
+// conversation is retried with model and the images left out.
+func (b *Bot) routeVision(chatHistory []Message, model string, complete completeFunc) (*Completion, error) {
+	if b.config.VisionModel == "" || !hasImages(chatHistory) {
+		return complete(chatHistory, model)
+	}
+
+	completion, err := complete(chatHistory, b.config.VisionModel)
+	if err == nil {
+		return completion, nil
+	}
+	log.Printf("Vision model %s failed, answering with %s without images: %v", b.config.VisionModel, model, err)
+	return complete(withoutImages(chatHistory, b.catalog.message("", "vision.omitted")), model)
+}
+
+func hasImages(chatHistory []Message) bool {
+	for _, msg := range chatHistory {
+		for _, c := range msg.ChatContent {
+			if c.ImageURL != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withoutImages replaces the images in each message with a note, formatted
+// from the number left out.
+func withoutImages(chatHistory []Message, note string) []Message {
+	out := make([]Message, len(chatHistory))
+	for i, msg := range chatHistory {
+		out[i] = Message{Role: msg.Role}
+		omitted := 0
+		for _, c := range msg.ChatContent {
+			if c.ImageURL != nil {
+				omitted++
+				continue
+			}
+			out[i].ChatContent = append(out[i].ChatContent, c)
+		}
+		if omitted > 0 {
+			out[i].ChatContent = append(out[i].ChatContent, ChatContent{
+				Type: "text",
+				Text: fmt.Sprintf(note, omitted),
+			})
+		}
+	}
+	return out
+}